@@ -1,11 +1,17 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"html"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"github.com/CalebQ42/darkstorm-server/internal/blog"
 )
 
 func latestBlogsHandle(w http.ResponseWriter, r *http.Request) {
@@ -17,7 +23,7 @@ func latestBlogsHandle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("error getting latest blogs:", err)
+		slog.ErrorContext(r.Context(), "error getting latest blogs", "err", err)
 		sendContent(w, r, "Error getting page", "", "")
 		return
 	}
@@ -37,7 +43,7 @@ func blogHandle(w http.ResponseWriter, r *http.Request, blog string) {
 			return
 		}
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("error getting blog %v: %v\n", blog, err)
+		slog.ErrorContext(r.Context(), "error getting blog", "blogID", blog, "err", err)
 		sendContent(w, r, "Error getting page", "", "")
 		return
 	}
@@ -70,3 +76,157 @@ func blogListHandle(w http.ResponseWriter, r *http.Request) {
 	}
 	sendContent(w, r, out, "", "")
 }
+
+func tagHandle(w http.ResponseWriter, r *http.Request) {
+	tags := blog.NormalizeTags([]string{r.PathValue("tag")})
+	if len(tags) == 0 {
+		w.WriteHeader(404)
+		sendContent(w, r, "Page not found", "", "")
+		return
+	}
+	tag := tags[0]
+	pag, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pag = max(pag, 0)
+	list, err := blogApp.TaggedBlogs(r.Context(), tag, int64(pag))
+	if err != nil && err != backend.ErrNotFound {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error getting tagged blogs", "tag", tag, "err", err)
+		sendContent(w, r, "Error getting page", "", "")
+		return
+	}
+	out := "<h2>Posts tagged #" + html.EscapeString(tag) + "</h2>"
+	if len(list) == 0 && pag == 0 {
+		out += "<p>No posts found</p>"
+	}
+	for i := range list {
+		out += "<p>" + list[i].HTMX() + "</p>"
+	}
+	if pag > 0 || len(list) == 50 {
+		base := "/tag/" + url.PathEscape(tag) + "?page="
+		out += "<div id='blog-list-page-selector'>"
+		if pag > 0 {
+			pagNum := strconv.Itoa(pag - 1)
+			out += "<a href='https://darkstorm.tech" + base + pagNum + "' hx-get='" + base + pagNum + "' hx-push-url='true' hx-target='#content'>&lt;Previous</a>"
+		}
+		if len(list) == 50 {
+			pagNum := strconv.Itoa(pag + 1)
+			out += "<a href='https://darkstorm.tech" + base + pagNum + "' hx-get='" + base + pagNum + "' hx-push-url='true' hx-target='#content'>Next&gt;</a>"
+		}
+		out += "</div>"
+	}
+	sendContent(w, r, out, "#"+tag, "")
+}
+
+const searchForm = "<form id='searchForm' action='https://darkstorm.tech/search' hx-get='/search' hx-push-url='true' hx-target='#content'>" +
+	"<input name='q' type='search' value='%v' placeholder='Search'/><button class='formButton' type='submit'>Search</button></form>"
+
+func searchHandle(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	out := fmt.Sprintf(searchForm, html.EscapeString(query))
+	if query == "" {
+		sendContent(w, r, out, "Search", "")
+		return
+	}
+	pag, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pag = max(pag, 0)
+	results, err := blogApp.Search(r.Context(), query, int64(pag))
+	if err != nil && err != backend.ErrNotFound {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error searching blogs", "err", err)
+		sendContent(w, r, out+"<p>Error searching</p>", "Search", "")
+		return
+	}
+	if len(results) == 0 && pag == 0 {
+		out += "<p>No results found</p>"
+	}
+	for i := range results {
+		out += results[i].HTMX()
+	}
+	if pag > 0 || len(results) == 20 {
+		base := "/search?q=" + url.QueryEscape(query) + "&page="
+		out += "<div id='blog-list-page-selector'>"
+		if pag > 0 {
+			pagNum := strconv.Itoa(pag - 1)
+			out += "<a href='https://darkstorm.tech" + base + pagNum + "' hx-get='" + base + pagNum + "' hx-push-url='true' hx-target='#content'>&lt;Previous</a>"
+		}
+		if len(results) == 20 {
+			pagNum := strconv.Itoa(pag + 1)
+			out += "<a href='https://darkstorm.tech" + base + pagNum + "' hx-get='" + base + pagNum + "' hx-push-url='true' hx-target='#content'>Next&gt;</a>"
+		}
+		out += "</div>"
+	}
+	sendContent(w, r, out, "Search: "+html.EscapeString(query), "")
+}
+
+const (
+	commentForm = "<form class='blog-comment-form' hx-post='/comments/%[1]v' hx-target='#comment-result-%[2]v'>" +
+		"<textarea name='comment' maxlength='%[3]v' required></textarea><div id='comment-result-%[2]v'></div>" +
+		"<button class='formButton' type='submit'>Comment</button></form>"
+	commentLogin = "<p><a href='https://darkstorm.tech/comment-login?blog=%[1]v' hx-get='/comment-login?blog=%[1]v' hx-push-url='true' hx-target='#content'>Login</a> to comment</p>"
+	// Commenters log in separately from the editor so they're sent back to the blog instead of the editor.
+	commentLoginPage = "<form id='loginForm' hx-post='/comment-login?blog=%v' hx-target='#formResult'>" +
+		"<label for='username'>Username:</label>" +
+		"<input name='username' id='usernameInput' onkeydown=\"return event.key != 'Enter';\" type='text'></input>" +
+		"<label for='password'>Password:</label>" +
+		"<input name='password' type='password' id='passwordInput'></input>" +
+		"<div id='formResult'></div>" +
+		"<button class='formButton' type='submit'>Login to comment</button></form>"
+)
+
+func commentLoginPageRequest(w http.ResponseWriter, r *http.Request) {
+	sendContent(w, r, fmt.Sprintf(commentLoginPage, html.EscapeString(url.QueryEscape(r.URL.Query().Get("blog")))), "", "")
+}
+
+func commentLoginRequest(w http.ResponseWriter, r *http.Request) {
+	if !loginUser(w, r) {
+		return
+	}
+	blogPath := "/" + url.PathEscape(r.URL.Query().Get("blog"))
+	sendContent(w, r, "<p hx-get='"+html.EscapeString(blogPath)+"' hx-push-url='true' hx-trigger='load' hx-target='#content'>Successful Login</p>", "", "")
+}
+
+// Comments are loaded into the blog's comment section, so they're written directly instead of with sendContent to keep the page's title.
+func commentsHandle(w http.ResponseWriter, r *http.Request) {
+	blogID := r.PathValue("blogID")
+	pag, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	out, err := blogApp.CommentsHTMX(r.Context(), blogID, int64(max(pag, 0)))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting blog comments", "blogID", blogID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("<p>Error getting comments</p>"))
+		return
+	}
+	if verifyEditorCookie(r) != nil {
+		out += fmt.Sprintf(commentForm, url.PathEscape(blogID), html.EscapeString(blogID), blog.MaxCommentLength)
+	} else {
+		out += fmt.Sprintf(commentLogin, html.EscapeString(url.QueryEscape(blogID)))
+	}
+	w.Write([]byte(out))
+}
+
+func commentPostHandle(w http.ResponseWriter, r *http.Request) {
+	blogID := r.PathValue("blogID")
+	usr := verifyEditorCookie(r)
+	if usr == nil {
+		w.Write([]byte(fmt.Sprintf(commentLogin, html.EscapeString(url.QueryEscape(blogID)))))
+		return
+	}
+	comment := strings.TrimSpace(r.FormValue("comment"))
+	if comment == "" || utf8.RuneCountInString(comment) > blog.MaxCommentLength {
+		w.Write([]byte("<p>Comments must be between 1 and " + strconv.Itoa(blog.MaxCommentLength) + " characters</p>"))
+		return
+	}
+	_, err := blogApp.AddComment(r.Context(), blogID, usr.Username, comment)
+	if err == backend.ErrNotFound {
+		w.Write([]byte("<p>Blog not found</p>"))
+		return
+	} else if err == blog.ErrCommentLimit {
+		w.Write([]byte("<p>You've posted too many comments recently. Try again later.</p>"))
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error adding blog comment", "blogID", blogID, "err", err)
+		w.Write([]byte("<p>Server error adding comment</p>"))
+		return
+	}
+	w.Write([]byte("<p>Thanks! Your comment will show up once it's approved.</p>"))
+}
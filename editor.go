@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -36,6 +40,12 @@ const (
 		<option value='{{.ID}}'{{if eq $.Selected .ID}} selected{{end}}>{{.Title}}</option>
 	{{end}}
 	</select>
+	<button class="formButton"
+			style="margin-left:10px"
+			hx-get="/editor/comments"
+			hx-target="#editor">
+		Comments
+	</button>
 </p>
 <div id="editor" hx-on::after-settle="blogEditorResize()">{{.Editor}}</div>`
 	editorForm = `
@@ -45,9 +55,13 @@ const (
 		<label for="staticPage" style="margin-right:10px">Static Page:</label><input type="checkbox" name="staticPage"{{if .Blog.StaticPage}} checked {{end}}/>
 		<span class="vertical-seperator"></span>
 		<label for="draft" style="margin-right:10px">Draft:</label><input type="checkbox" name="draft"{{if or .Blog.Draft (not .Blog.ID)}} checked {{end}}/>
+		<span class="vertical-seperator"></span>
+		<label for="publishAt" style="margin-right:10px">Publish at (UTC):</label><input type="datetime-local" name="publishAt" value="{{publishAt .Blog.PublishAt}}"/>
 	</p>
 	<label for="title">Title</label>
 	<input id="titleInput" name="title" value="{{.Blog.Title}}" type="text" onkeydown="return event.key != 'Enter';"/>
+	<label for="tags">Tags (comma separated)</label>
+	<input id="tagsInput" name="tags" value="{{join .Blog.Tags ", "}}" type="text" onkeydown="return event.key != 'Enter';"/>
 	<textarea id="blogEditor" name="blog" oninput="blogEditorResize()">{{.Blog.RawBlog}}</textarea>
 	<div id="formResult">{{.Result}}</div>
 	<p style="margin-right:0px;display:flex;">
@@ -66,10 +80,89 @@ const (
 				hx-confirm="Delete Page????">
 			Delete
 		</button>
+		{{if .Blog.ID}}
+		<span style="flex-grow:1;"></span>
+		<button class="formButton"
+				type="button"
+				hx-get="/editor/revisions?blog={{query .Blog.ID}}"
+				hx-target="#editor">
+			History
+		</button>
+		{{end}}
 		<span style="flex-grow:1;"></span>
 		<button class="formButton" type="submit">{{if eq .Blog.ID ""}}Create{{else}}Update{{end}}</button>
 	<p>
 </form>`
+	revisionsPage = `
+<form id="revisionsForm" hx-get="/editor/diff" hx-target="#revisionDiff">
+	<input name="blog" type="hidden" value="{{escape .BlogID}}"></input>
+	<table class="revisions">
+		<tr><th>From</th><th>To</th><th>Time</th><th>Editor</th><th>Title</th><th></th></tr>
+	{{range $i, $rev := .Revisions}}
+		<tr>
+			<td><input type="radio" name="from" value="{{.ID}}"{{if eq $i 1}} checked{{end}}/></td>
+			<td><input type="radio" name="to" value="{{.ID}}"{{if eq $i 0}} checked{{end}}/></td>
+			<td>{{date .Time}}</td>
+			<td>{{escape .Editor}}</td>
+			<td>{{escape .Title}}</td>
+			<td>
+				<button class="formButton"
+						type="button"
+						hx-post="/editor/restore?blog={{query $.BlogID}}&revision={{query .ID}}"
+						hx-target="#editor"
+						hx-confirm="Restore this revision, overwritting the current values??">
+					Restore
+				</button>
+			</td>
+		</tr>
+	{{end}}
+	</table>
+	<p style="margin-right:0px;display:flex;">
+		<button class="formButton"
+				type="button"
+				hx-get="/editor/edit"
+				hx-include="#blogSelect"
+				hx-target="#editor">
+			Back
+		</button>
+		<span style="flex-grow:1;"></span>
+		<button class="formButton" type="submit">Compare</button>
+	</p>
+</form>
+<div id="revisionDiff"></div>`
+	commentsPage = `
+<h3>Comments waiting for approval</h3>
+{{range .Comments}}
+<div class="pending-comment">
+	<p><b>{{escape .Author}}</b> on <a href="https://darkstorm.tech/{{path .BlogID}}" target="_blank">{{escape .BlogID}}</a> <i>{{date .Time}}</i></p>
+	<p>{{comment .Comment}}</p>
+	<p style="margin-right:0px;display:flex;">
+		<button class="formButton"
+				hx-post="/editor/comments/approve?blog={{query .BlogID}}&comment={{query .ID}}"
+				hx-target="closest .pending-comment"
+				hx-swap="outerHTML">
+			Approve
+		</button>
+		<span style="flex-grow:1;"></span>
+		<button class="formButton"
+				hx-delete="/editor/comments?blog={{query .BlogID}}&comment={{query .ID}}"
+				hx-target="closest .pending-comment"
+				hx-swap="outerHTML"
+				hx-confirm="Delete comment??">
+			Delete
+		</button>
+	</p>
+</div>
+{{else}}
+<p>No comments waiting for approval</p>
+{{end}}
+{{if or (gt .Page 0) .HasNext}}
+<p style="margin-right:0px;display:flex;">
+	{{if gt .Page 0}}<button class="formButton" hx-get="/editor/comments?page={{.Prev}}" hx-target="#editor">&lt;Previous</button>{{end}}
+	<span style="flex-grow:1;"></span>
+	{{if .HasNext}}<button class="formButton" hx-get="/editor/comments?page={{.Next}}" hx-target="#editor">Next&gt;</button>{{end}}
+</p>
+{{end}}`
 )
 
 func loginPageRequest(w http.ResponseWriter, r *http.Request) {
@@ -77,14 +170,22 @@ func loginPageRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func trueLoginRequest(w http.ResponseWriter, r *http.Request) {
+	if !loginUser(w, r) {
+		return
+	}
+	sendContent(w, r, "<p hx-get='/editor' hx-push-url='true' hx-trigger='load' hx-target='#content'>Successful Login</p>", "", "")
+}
+
+// Logs in the user from the request's form and sets the blogAuthToken cookie. If the login fails, the reason is sent and false is returned.
+func loginUser(w http.ResponseWriter, r *http.Request) bool {
 	if r.Header.Get("HX-Request") != "true" {
 		sendContent(w, r, "<p>Bad request</p>", "", "")
-		return
+		return false
 	}
 	err := r.ParseForm()
 	if err != nil {
 		sendContent(w, r, "<p>Bad request</p>", "", "")
-		return
+		return false
 	}
 	u, err := back.TryLogin(r.Context(), r.FormValue("username"), r.FormValue("password"))
 	if err != nil {
@@ -94,24 +195,29 @@ func trueLoginRequest(w http.ResponseWriter, r *http.Request) {
 		case backend.ErrLoginIncorrect:
 			sendContent(w, r, "<p>Username or password invalid</p>", "", "")
 		default:
-			log.Println("error trying to login:", err)
+			slog.ErrorContext(r.Context(), "error trying to login", "err", err)
 			sendContent(w, r, "<p>Server error</p>", "", "")
 		}
-		return
+		return false
 	}
 	tok, err := back.GenerateJWT(u.ToReqUser())
 	if err != nil {
-		log.Println("error trying to generate JWT:", err)
+		slog.ErrorContext(r.Context(), "error trying to generate JWT", "err", err)
 		sendContent(w, r, "<p>Server error</p>", "", "")
-		return
+		return false
 	}
 	w.Header().Set("Set-Cookie", "blogAuthToken="+tok+"; Secure; Max-Age=43170; SameSite=Lax") // Max-Age is 11.5 hours. JWTs are valid for 12 hours.
-	sendContent(w, r, "<p hx-get='/editor' hx-push-url='true' hx-trigger='load' hx-target='#content'>Successful Login</p>", "", "")
+	return true
 }
 
+// Format of datetime-local inputs.
+const publishAtFormat = "2006-01-02T15:04"
+
 var (
-	pageTmpl *template.Template
-	formTmpl *template.Template
+	pageTmpl      *template.Template
+	formTmpl      *template.Template
+	revisionsTmpl *template.Template
+	commentsTmpl  *template.Template
 )
 
 type pageTmplStruct struct {
@@ -125,13 +231,59 @@ type formTmplStruct struct {
 	Result string
 }
 
+type commentsTmplStruct struct {
+	Comments []blog.Comment
+	Page     int
+	Prev     int
+	Next     int
+	HasNext  bool
+}
+
+type revisionsTmplStruct struct {
+	BlogID    string
+	Revisions []blog.Revision
+}
+
 func setupEditorTemplates() error {
 	var err error
 	pageTmpl, err = template.New("page").Parse(editorPage)
 	if err != nil {
 		return err
 	}
-	formTmpl, err = template.New("form").Parse(editorForm)
+	formTmpl, err = template.New("form").Funcs(template.FuncMap{
+		"join":  strings.Join,
+		"query": url.QueryEscape,
+		"publishAt": func(t int64) string {
+			if t == 0 {
+				return ""
+			}
+			return time.Unix(t, 0).UTC().Format(publishAtFormat)
+		},
+	}).Parse(editorForm)
+	if err != nil {
+		return err
+	}
+	revisionsTmpl, err = template.New("revisions").Funcs(template.FuncMap{
+		"escape": html.EscapeString,
+		"query":  url.QueryEscape,
+		"date": func(t int64) string {
+			return time.Unix(t, 0).Format("Jan 2, 2006 3:04 PM")
+		},
+	}).Parse(revisionsPage)
+	if err != nil {
+		return err
+	}
+	commentsTmpl, err = template.New("comments").Funcs(template.FuncMap{
+		"escape": html.EscapeString,
+		"query":  url.QueryEscape,
+		"path":   url.PathEscape,
+		"date": func(t int64) string {
+			return time.Unix(t, 0).Format("Jan 2, 2006 3:04 PM")
+		},
+		"comment": func(c string) string {
+			return strings.ReplaceAll(html.EscapeString(c), "\n", "<br>")
+		},
+	}).Parse(commentsPage)
 	if err != nil {
 		return err
 	}
@@ -139,20 +291,19 @@ func setupEditorTemplates() error {
 }
 
 func editorRequest(w http.ResponseWriter, r *http.Request) {
-	if verifyEditorCookie(r) == nil {
-		editorRedirect(w, r, "/login")
+	if verifyEditorAdmin(w, r) == nil {
 		return
 	}
 	blogs, err := blogApp.AllBlogsList(r.Context())
 	if err != nil {
-		log.Println("error getting all blogs:", err)
+		slog.ErrorContext(r.Context(), "error getting all blogs", "err", err)
 		sendContent(w, r, "ERROR", "", "")
 		return
 	}
 	buf := new(bytes.Buffer)
 	err = pageTmpl.Execute(buf, pageTmplStruct{Blogs: blogs})
 	if err != nil {
-		log.Println("error executing editor page template:", err)
+		slog.ErrorContext(r.Context(), "error executing editor page template", "err", err)
 		sendContent(w, r, "ERROR", "", "")
 		return
 	}
@@ -160,8 +311,7 @@ func editorRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func editorEdit(w http.ResponseWriter, r *http.Request) {
-	if verifyEditorCookie(r) == nil {
-		editorRedirect(w, r, "/login")
+	if verifyEditorAdmin(w, r) == nil {
 		return
 	}
 	var bl *blog.Blog
@@ -176,8 +326,7 @@ func editorEdit(w http.ResponseWriter, r *http.Request) {
 	} else {
 		bl, err = blogApp.AnyBlog(r.Context(), blogID)
 		if err != nil {
-			log.Println("error getting blog for editor:", err)
-			log.Println(blogID)
+			slog.ErrorContext(r.Context(), "error getting blog for editor", "blogID", blogID, "err", err)
 			sendContent(w, r, "ERROR", "", "")
 			return
 		}
@@ -185,7 +334,7 @@ func editorEdit(w http.ResponseWriter, r *http.Request) {
 	buf := new(bytes.Buffer)
 	err = formTmpl.Execute(buf, formTmplStruct{Blog: *bl})
 	if err != nil {
-		log.Println("error executing editor template:", err)
+		slog.ErrorContext(r.Context(), "error executing editor template", "err", err)
 		sendContent(w, r, "ERROR", "", "")
 		return
 	}
@@ -193,13 +342,8 @@ func editorEdit(w http.ResponseWriter, r *http.Request) {
 }
 
 func editorPost(w http.ResponseWriter, r *http.Request) {
-	usr := verifyEditorCookie(r)
+	usr := verifyEditorAdmin(w, r)
 	if usr == nil {
-		editorRedirect(w, r, "/login")
-		return
-	}
-	if usr.Perm["blog"] != "admin" {
-		sendContent(w, r, "<p>You are not allowed to perform this action. Sorry, not sorry.</p>", "", "")
 		return
 	}
 	err := r.ParseForm()
@@ -213,30 +357,39 @@ func editorPost(w http.ResponseWriter, r *http.Request) {
 		RawBlog:    r.FormValue("blog"),
 		Draft:      r.FormValue("draft") == "on",
 		StaticPage: r.FormValue("staticPage") == "on",
+		Tags:       blog.ParseTags(r.FormValue("tags")),
 	}
 	if newBlog.Title == "" || newBlog.RawBlog == "" {
 		sendContent(w, r, "<p>Title and Blog content required</p>", "", "")
 		return
 	}
+	if pub := r.FormValue("publishAt"); pub != "" {
+		pubTime, err := time.Parse(publishAtFormat, pub)
+		if err != nil {
+			sendContent(w, r, "<p>Invalid publish time</p>", "", "")
+			return
+		}
+		newBlog.PublishAt = pubTime.Unix()
+	}
+	now := time.Now().Unix()
 	if newBlog.ID == "" {
 		newBlog.ID = newBlog.IDFromTitle()
 		if blogApp.Contains(r.Context(), newBlog.ID) {
 			sendContent(w, r, "<p>Title is not unique!</p>", "", "")
 			return
 		}
-		now := time.Now()
-		newBlog.CreateTime = now.Unix()
+		newBlog.CreateTime = max(now, newBlog.PublishAt)
 		newBlog.Author = usr.Username
 		err = blogApp.InsertBlog(r.Context(), newBlog)
 		if err != nil {
-			log.Println("error creating new blog ID:", err)
+			slog.ErrorContext(r.Context(), "error creating new blog ID", "err", err)
 			sendContent(w, r, "<p>Error inserting into DB</p>", "", "")
 			return
 		}
 		var blogs []blog.BlogListResult
 		blogs, err = blogApp.AllBlogsList(r.Context())
 		if err != nil {
-			log.Println("error getting all blogs list:", err)
+			slog.ErrorContext(r.Context(), "error getting all blogs list", "err", err)
 			sendContent(w, r, "<p>Successfully save, but page reload failed</p>", "", "")
 			return
 		}
@@ -246,21 +399,27 @@ func editorPost(w http.ResponseWriter, r *http.Request) {
 		pageTmpl.Execute(w, pageTmplStruct{Selected: newBlog.ID, Blogs: blogs, Editor: newForm.String()})
 		return
 	}
-	err = blogApp.UpdateBlog(r.Context(), newBlog.ID,
-		bson.M{
-			"updateTime": time.Now().Unix(),
-			"title":      newBlog.Title,
-			"blog":       newBlog.RawBlog,
-			"draft":      newBlog.Draft,
-			"staticPage": newBlog.StaticPage})
+	upd := bson.M{
+		"updateTime": now,
+		"title":      newBlog.Title,
+		"blog":       newBlog.RawBlog,
+		"draft":      newBlog.Draft,
+		"staticPage": newBlog.StaticPage,
+		"publishAt":  newBlog.PublishAt,
+		"tags":       newBlog.Tags}
+	if newBlog.PublishAt > now {
+		// Scheduled blogs are dated when they're published.
+		upd["createTime"] = newBlog.PublishAt
+	}
+	err = blogApp.UpdateBlog(r.Context(), newBlog.ID, usr.Username, upd)
 	if err != nil {
-		log.Println("error updating blog:", err)
+		slog.ErrorContext(r.Context(), "error updating blog", "err", err)
 		sendContent(w, r, "<p>Server error updating blog</p>", "", "")
 		return
 	}
 	old, err := blogApp.AnyBlog(r.Context(), newBlog.ID)
 	if err != nil {
-		log.Println("error getting old blog to be updated:", err)
+		slog.ErrorContext(r.Context(), "error getting old blog to be updated", "err", err)
 		sendContent(w, r, "<p>Updated!</p>", "", "")
 		return
 	}
@@ -271,7 +430,7 @@ func editorPost(w http.ResponseWriter, r *http.Request) {
 	var blogs []blog.BlogListResult
 	blogs, err = blogApp.AllBlogsList(r.Context())
 	if err != nil {
-		log.Println("error getting all blogs list:", err)
+		slog.ErrorContext(r.Context(), "error getting all blogs list", "err", err)
 		sendContent(w, r, "<p>Updated!</p>", "", "")
 		return
 	}
@@ -282,13 +441,7 @@ func editorPost(w http.ResponseWriter, r *http.Request) {
 }
 
 func editorDelete(w http.ResponseWriter, r *http.Request) {
-	usr := verifyEditorCookie(r)
-	if usr == nil {
-		editorRedirect(w, r, "/login")
-		return
-	}
-	if usr.Perm["blog"] != "admin" {
-		sendContent(w, r, "<p>You are not allowed to perform this action. Sorry, not sorry.</p>", "", "")
+	if verifyEditorAdmin(w, r) == nil {
 		return
 	}
 	err := r.ParseForm()
@@ -303,14 +456,14 @@ func editorDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	err = blogApp.RemoveBlog(r.Context(), id)
 	if err != nil {
-		log.Println("error updating blog:", err)
+		slog.ErrorContext(r.Context(), "error updating blog", "err", err)
 		sendContent(w, r, "<p>Server error removing blog</p>", "", "")
 		return
 	}
 	var blogs []blog.BlogListResult
 	blogs, err = blogApp.AllBlogsList(r.Context())
 	if err != nil {
-		log.Println("error getting all blogs list:", err)
+		slog.ErrorContext(r.Context(), "error getting all blogs list", "err", err)
 		sendContent(w, r, "<p>Updated!</p>", "", "")
 		return
 	}
@@ -318,18 +471,173 @@ func editorDelete(w http.ResponseWriter, r *http.Request) {
 	pageTmpl.Execute(w, pageTmplStruct{Selected: "", Blogs: blogs, Editor: "<p>Blog removed!</p>"})
 }
 
+func editorRevisions(w http.ResponseWriter, r *http.Request) {
+	if verifyEditorAdmin(w, r) == nil {
+		return
+	}
+	blogID := r.URL.Query().Get("blog")
+	if blogID == "" {
+		sendContent(w, r, "<p>Select a blog!</p>", "", "")
+		return
+	}
+	revs, err := blogApp.Revisions(r.Context(), blogID)
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting blog revisions", "blogID", blogID, "err", err)
+		sendContent(w, r, "ERROR", "", "")
+		return
+	}
+	if len(revs) == 0 {
+		sendContent(w, r, "<p>No revisions saved</p>", "", "")
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = revisionsTmpl.Execute(buf, revisionsTmplStruct{BlogID: blogID, Revisions: revs})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error executing revisions template", "err", err)
+		sendContent(w, r, "ERROR", "", "")
+		return
+	}
+	sendContent(w, r, buf.String(), "", "")
+}
+
+func editorDiff(w http.ResponseWriter, r *http.Request) {
+	if verifyEditorAdmin(w, r) == nil {
+		return
+	}
+	blogID := r.URL.Query().Get("blog")
+	from, err := blogApp.Revision(r.Context(), blogID, r.URL.Query().Get("from"))
+	if err == nil {
+		var to *blog.Revision
+		to, err = blogApp.Revision(r.Context(), blogID, r.URL.Query().Get("to"))
+		if err == nil {
+			sendContent(w, r, blog.DiffHTML(*from, *to), "", "")
+			return
+		}
+	}
+	if err == backend.ErrNotFound {
+		sendContent(w, r, "<p>Select two revisions</p>", "", "")
+		return
+	}
+	slog.ErrorContext(r.Context(), "error getting revisions to diff", "blogID", blogID, "err", err)
+	sendContent(w, r, "ERROR", "", "")
+}
+
+func editorRestore(w http.ResponseWriter, r *http.Request) {
+	usr := verifyEditorAdmin(w, r)
+	if usr == nil {
+		return
+	}
+	blogID := r.FormValue("blog")
+	err := blogApp.RestoreRevision(r.Context(), blogID, r.FormValue("revision"), usr.Username)
+	if err == backend.ErrNotFound {
+		sendContent(w, r, "<p>Revision not found</p>", "", "")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error restoring blog revision", "blogID", blogID, "err", err)
+		sendContent(w, r, "<p>Server error restoring revision</p>", "", "")
+		return
+	}
+	bl, err := blogApp.AnyBlog(r.Context(), blogID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting restored blog", "blogID", blogID, "err", err)
+		sendContent(w, r, "<p>Restored!</p>", "", "")
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = formTmpl.Execute(buf, formTmplStruct{Blog: *bl, Result: "<p>Restored!</p>"})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error executing editor template", "err", err)
+		sendContent(w, r, "<p>Restored!</p>", "", "")
+		return
+	}
+	sendContent(w, r, buf.String(), "", "")
+}
+
+func editorComments(w http.ResponseWriter, r *http.Request) {
+	if verifyEditorAdmin(w, r) == nil {
+		return
+	}
+	pag, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pag = max(pag, 0)
+	comments, err := blogApp.PendingComments(r.Context(), int64(pag))
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting pending comments", "err", err)
+		sendContent(w, r, "ERROR", "", "")
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = commentsTmpl.Execute(buf, commentsTmplStruct{
+		Comments: comments,
+		Page:     pag,
+		Prev:     pag - 1,
+		Next:     pag + 1,
+		HasNext:  len(comments) == blog.CommentPageSize,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error executing comments template", "err", err)
+		sendContent(w, r, "ERROR", "", "")
+		return
+	}
+	sendContent(w, r, buf.String(), "", "")
+}
+
+func editorApproveComment(w http.ResponseWriter, r *http.Request) {
+	if verifyEditorAdmin(w, r) == nil {
+		return
+	}
+	commentID := r.FormValue("comment")
+	err := blogApp.ApproveComment(r.Context(), r.FormValue("blog"), commentID)
+	if err == backend.ErrNotFound {
+		sendContent(w, r, "<p>Comment not found</p>", "", "")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error approving comment", "commentID", commentID, "err", err)
+		sendContent(w, r, "<p>Server error approving comment</p>", "", "")
+		return
+	}
+	sendContent(w, r, "<p>Comment approved!</p>", "", "")
+}
+
+func editorDeleteComment(w http.ResponseWriter, r *http.Request) {
+	if verifyEditorAdmin(w, r) == nil {
+		return
+	}
+	commentID := r.FormValue("comment")
+	err := blogApp.RemoveComment(r.Context(), r.FormValue("blog"), commentID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error removing comment", "commentID", commentID, "err", err)
+		sendContent(w, r, "<p>Server error removing comment</p>", "", "")
+		return
+	}
+	sendContent(w, r, "<p>Comment removed!</p>", "", "")
+}
+
+// Verifies the user is logged in and a blog admin. If not, the user is redirected to the login page or told they aren't allowed and nil is returned.
+func verifyEditorAdmin(w http.ResponseWriter, r *http.Request) *backend.User {
+	usr := verifyEditorCookie(r)
+	if usr == nil {
+		editorRedirect(w, r, "/login")
+		return nil
+	}
+	if usr.Perm["blog"] != "admin" {
+		sendContent(w, r, "<p>You are not allowed to perform this action. Sorry, not sorry.</p>", "", "")
+		return nil
+	}
+	return usr
+}
+
 func verifyEditorCookie(r *http.Request) *backend.User {
 	authCookie, err := r.Cookie("blogAuthToken")
 	if err != nil {
 		if err != http.ErrNoCookie {
-			log.Println("error getting auth cookie:", err)
+			slog.ErrorContext(r.Context(), "error getting auth cookie", "err", err)
 		}
 		return nil
 	}
 	usr, err := back.VerifyUser(r.Context(), authCookie.Value)
 	if err != nil {
 		if err != backend.ErrTokenUnauthorized {
-			log.Println("error authorizing JWT token:", err)
+			slog.ErrorContext(r.Context(), "error authorizing JWT token", "err", err)
 		}
 		return nil
 	}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -25,7 +25,7 @@ func filesRequest(w http.ResponseWriter, r *http.Request) {
 		} else {
 			pageContent = "<p>Server error!</p>"
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("error serving files:", err)
+			slog.ErrorContext(r.Context(), "error serving files", "err", err)
 		}
 	} else {
 		stat, _ := fil.Stat()
@@ -38,7 +38,7 @@ func filesRequest(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				pageContent = "<p>Server error!</p>"
 				w.WriteHeader(http.StatusInternalServerError)
-				log.Println("error serving files:", err)
+				slog.ErrorContext(r.Context(), "error serving files", "err", err)
 			}
 			for _, f := range dirs {
 				if f.IsDir() {
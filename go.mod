@@ -6,6 +6,7 @@ require (
 	github.com/CalebQ42/bbConvert v1.0.7
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.6.0
+	github.com/inetaf/tcpproxy v0.0.0-20260515195445-c159a6051109
 	github.com/lithammer/shortuuid/v3 v3.0.7
 	go.mongodb.org/mongo-driver v1.17.1
 	golang.org/x/crypto v0.31.0
@@ -14,7 +15,6 @@ require (
 require (
 	github.com/dlclark/regexp2 v1.11.5-0.20240806004527-5bbbed8ea10b // indirect
 	github.com/golang/snappy v0.0.4 // indirect
-	github.com/inetaf/tcpproxy v0.0.0-20260515195445-c159a6051109 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A message shown to users of one or more Apps, such as an outage or a new version.
+type Announcement struct {
+	ID string `json:"id" bson:"_id"`
+	// Apps the announcement is shown in. If empty, it's shown in every App.
+	Apps    []string `json:"apps,omitempty" bson:"apps,omitempty"`
+	Title   string   `json:"title" bson:"title"`
+	Message string   `json:"message" bson:"message"`
+	// info, warning, or critical.
+	Severity string `json:"severity" bson:"severity"`
+	// unix timestamp (seconds)
+	Start int64 `json:"start" bson:"start"`
+	// unix timestamp (seconds). If 0, the announcement is shown until it's deleted.
+	End int64 `json:"end,omitempty" bson:"end,omitempty"`
+	// If empty, the announcement is shown on all platforms.
+	Platforms []string `json:"platforms,omitempty" bson:"platforms,omitempty"`
+	// Minimum version, inclusive.
+	MinVersion string `json:"minVersion,omitempty" bson:"minVersion,omitempty"`
+	// Maximum version, inclusive.
+	MaxVersion string `json:"maxVersion,omitempty" bson:"maxVersion,omitempty"`
+	// unix timestamp (seconds)
+	Created int64 `json:"created" bson:"created"`
+}
+
+func (a Announcement) GetID() string {
+	return a.ID
+}
+
+// If the announcement is shown in the App.
+func (a Announcement) InApp(appID string) bool {
+	return len(a.Apps) == 0 || slices.Contains(a.Apps, appID)
+}
+
+// If the announcement should be shown at the given time.
+func (a Announcement) ActiveAt(t time.Time) bool {
+	now := t.Unix()
+	return a.Start <= now && (a.End == 0 || now < a.End)
+}
+
+// If the announcement targets the given client. An empty platform matches every announcement.
+func (a Announcement) Targets(platform, version string) bool {
+	if platform != "" && len(a.Platforms) > 0 && !slices.Contains(a.Platforms, platform) {
+		return false
+	}
+	return inVersionRange(version, a.MinVersion, a.MaxVersion)
+}
+
+// Higher is more severe.
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 2
+	case "warning":
+		return 1
+	}
+	return 0
+}
+
+type announcementReq struct {
+	// Only the management key can create announcements for other Apps or every App. Defaults to the key's App.
+	Apps    []string `json:"apps" validate:"max=64"`
+	Title   string   `json:"title" validate:"required,max=256"`
+	Message string   `json:"message" validate:"required,max=4096"`
+	// Defaults to info.
+	Severity string `json:"severity" validate:"oneof=info warning critical"`
+	// Defaults to the current time.
+	Start      int64    `json:"start"`
+	End        int64    `json:"end"`
+	Platforms  []string `json:"platforms" validate:"max=32"`
+	MinVersion string   `json:"minVersion" validate:"max=64"`
+	MaxVersion string   `json:"maxVersion" validate:"max=64"`
+}
+
+var (
+	getAnnouncementsDoc = RouteDoc{
+		Summary:     "Get active announcements",
+		Description: "Returns the announcements currently shown in the key's App, most severe first.",
+		Tags:        []string{"announcement"},
+		Query: []Param{
+			{Name: "platform", Description: "Client's platform."},
+			{Name: "version", Description: "Client's App version."},
+		},
+		Response: ObjectSchema(map[string]any{"announcements": []Announcement{}}),
+	}
+	getAllAnnouncementsDoc = RouteDoc{
+		Summary:     "Get all announcements",
+		Description: "Includes announcements that haven't started or have ended. Unless using the management key, only announcements shown in the key's App are returned.",
+		Tags:        []string{"announcement"},
+		Permission:  "management",
+		Response:    ObjectSchema(map[string]any{"announcements": []Announcement{}}),
+	}
+	addAnnouncementDoc = RouteDoc{
+		Summary:     "Create an announcement",
+		Description: "Unless using the management key, the announcement can only be shown in the key's App.",
+		Tags:        []string{"announcement"},
+		Permission:  "management",
+		Request:     announcementReq{},
+		Response:    Announcement{},
+		Status:      http.StatusCreated,
+	}
+	deleteAnnouncementDoc = RouteDoc{
+		Summary:     "Delete an announcement",
+		Description: "Unless using the management key, only announcements that are only shown in the key's App can be deleted.",
+		Tags:        []string{"announcement"},
+		Permission:  "management",
+		Response:    ObjectSchema(map[string]any{"id": ""}),
+	}
+)
+
+// Enables announcements for all Apps. Announcements are stored in tab.
+func (b *Backend) EnableAnnouncements(tab Table[Announcement]) {
+	b.announcementTable = tab
+	b.m.HandleDoc("GET /announcements", b.getAnnouncements, getAnnouncementsDoc)
+	b.m.HandleDoc("GET /announcements/all", b.getAllAnnouncements, getAllAnnouncementsDoc)
+	b.m.HandleDoc("POST /announcements", b.addAnnouncement, addAnnouncementDoc)
+	b.m.HandleDoc("DELETE /announcements/{announcementID}", b.deleteAnnouncement, deleteAnnouncementDoc)
+}
+
+// Get all announcements shown in the App, sorted by severity then start time, newest first.
+// If appID is empty, all announcements are returned.
+func (b *Backend) appAnnouncements(r *http.Request, appID string) ([]Announcement, error) {
+	all, err := b.announcementTable.Find(r.Context(), map[string]any{})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	if appID != "" {
+		all = slices.DeleteFunc(all, func(a Announcement) bool {
+			return !a.InApp(appID)
+		})
+	}
+	slices.SortFunc(all, func(a, b Announcement) int {
+		if c := cmp.Compare(severityRank(b.Severity), severityRank(a.Severity)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Start, a.Start)
+	})
+	if all == nil {
+		all = []Announcement{}
+	}
+	return all, nil
+}
+
+func (b *Backend) getAnnouncements(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	all, err := b.appAnnouncements(r, hdr.Key.AppID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting announcements", "app", hdr.Key.AppID, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	q := r.URL.Query()
+	now := time.Now()
+	all = slices.DeleteFunc(all, func(a Announcement) bool {
+		return !a.ActiveAt(now) || !a.Targets(q.Get("platform"), q.Get("version"))
+	})
+	w.Header().Set("Cache-Control", "max-age=60")
+	WriteJSON(w, http.StatusOK, map[string][]Announcement{"announcements": all})
+}
+
+func (b *Backend) getAllAnnouncements(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	appID := hdr.Key.AppID
+	if b.isManagementKey(hdr.Key) {
+		appID = ""
+	}
+	all, err := b.appAnnouncements(r, appID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting announcements", "app", hdr.Key.AppID, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string][]Announcement{"announcements": all})
+}
+
+func (b *Backend) addAnnouncement(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	var req announcementReq
+	if !DecodeJSON(w, r, &req) {
+		return
+	}
+	if !b.isManagementKey(hdr.Key) {
+		if len(req.Apps) > 1 || (len(req.Apps) == 1 && req.Apps[0] != hdr.Key.AppID) {
+			WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
+			return
+		}
+		req.Apps = []string{hdr.Key.AppID}
+	}
+	for _, appID := range req.Apps {
+		if b.app(appID) == nil {
+			WriteErrorDetails(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request: unknown app "+appID,
+				map[string]any{"fields": map[string]string{"apps": "unknown app " + appID}})
+			return
+		}
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating announcement ID", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	now := time.Now().Unix()
+	ann := Announcement{
+		ID:         id.String(),
+		Apps:       req.Apps,
+		Title:      req.Title,
+		Message:    req.Message,
+		Severity:   req.Severity,
+		Start:      req.Start,
+		End:        req.End,
+		Platforms:  req.Platforms,
+		MinVersion: req.MinVersion,
+		MaxVersion: req.MaxVersion,
+		Created:    now,
+	}
+	if ann.Severity == "" {
+		ann.Severity = "info"
+	}
+	if ann.Start == 0 {
+		ann.Start = now
+	}
+	if ann.End != 0 && ann.End <= ann.Start {
+		WriteErrorDetails(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request: end must be after start",
+			map[string]any{"fields": map[string]string{"end": "must be after start"}})
+		return
+	}
+	err = b.announcementTable.Insert(r.Context(), ann)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error saving announcement", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	slog.InfoContext(r.Context(), "announcement created", "id", ann.ID, "apps", ann.Apps, "severity", ann.Severity)
+	WriteJSON(w, http.StatusCreated, ann)
+}
+
+func (b *Backend) deleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	id := r.PathValue("announcementID")
+	if !b.isManagementKey(hdr.Key) {
+		ann, err := b.announcementTable.Get(r.Context(), id)
+		if err == ErrNotFound {
+			WriteSuccess(w, http.StatusOK, map[string]string{"id": id})
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "error getting announcement", "id", id, "err", err)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+			return
+		}
+		if len(ann.Apps) != 1 || ann.Apps[0] != hdr.Key.AppID {
+			WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
+			return
+		}
+	}
+	err = b.announcementTable.Remove(r.Context(), id)
+	if err != nil && err != ErrNotFound {
+		slog.ErrorContext(r.Context(), "error deleting announcement", "id", id, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteSuccess(w, http.StatusOK, map[string]string{"id": id})
+}
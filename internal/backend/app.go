@@ -2,7 +2,7 @@ package backend
 
 import (
 	"context"
-	"net/http"
+	"time"
 )
 
 // An application interface. Both LogTable and CrashTable are optional, if they return nil then requests will be forbidden.
@@ -24,10 +24,17 @@ type CrashFilterApp interface {
 	ShouldAddCrash(context.Context, IndividualCrash) bool
 }
 
-// Allows an app more flexibility by directly interfacing with the backend's mux
+// Allows for an App to set how long count logs are kept. If not implemented, DefaultLogRetention is used.
+type RetentionApp interface {
+	App
+	LogRetention() time.Duration
+}
+
+// Allows an app more flexibility by directly interfacing with the backend's mux.
+// Routes added with Router.HandleDoc are included in the OpenAPI specification.
 type ExtendedApp interface {
 	App
-	Extension(*http.ServeMux)
+	Extension(*Router)
 }
 
 type simpleApp struct {
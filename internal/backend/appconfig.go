@@ -0,0 +1,307 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAppConfigDisabled = errors.New("app configuration is not enabled")
+	ErrInvalidAppID      = errors.New("AppID may only contain letters, numbers, - and _")
+
+	appIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Configuration of a simple App that only uses count and crash tracking.
+// Allows new Apps to be added from a configuration file or with POST /apps instead of a code change.
+type AppConfig struct {
+	ID string `json:"id" bson:"_id" validate:"required,max=64"`
+	// If the App uses count tracking. Count history is also recorded.
+	Count bool `json:"count" bson:"count"`
+	// If the App uses crash reporting.
+	Crash bool `json:"crash" bson:"crash"`
+	// Only crashes from these versions are added. If empty, crashes from all versions are added.
+	AllowedVersions []string `json:"allowedVersions,omitempty" bson:"allowedVersions,omitempty"`
+	// Database the App's tables are stored in. Defaults to the App's ID.
+	Database    string         `json:"database,omitempty" bson:"database,omitempty" validate:"max=64"`
+	Collections AppCollections `json:"collections" bson:"collections"`
+}
+
+func (a AppConfig) GetID() string {
+	return a.ID
+}
+
+// Collection names of an App created from an AppConfig. Defaults match the compiled Apps.
+type AppCollections struct {
+	Count        string `json:"count,omitempty" bson:"count,omitempty" validate:"max=64"`               // Defaults to logs.
+	CountHistory string `json:"countHistory,omitempty" bson:"countHistory,omitempty" validate:"max=64"` // Defaults to countHistory.
+	Crash        string `json:"crash,omitempty" bson:"crash,omitempty" validate:"max=64"`               // Defaults to crashes.
+	CrashArchive string `json:"crashArchive,omitempty" bson:"crashArchive,omitempty" validate:"max=64"` // Defaults to crashArchive.
+}
+
+// Fill in the default database and collection names.
+func (a AppConfig) withDefaults() AppConfig {
+	if a.Database == "" {
+		a.Database = a.ID
+	}
+	def := func(val *string, name string) {
+		if *val == "" {
+			*val = name
+		}
+	}
+	def(&a.Collections.Count, "logs")
+	def(&a.Collections.CountHistory, "countHistory")
+	def(&a.Collections.Crash, "crashes")
+	def(&a.Collections.CrashArchive, "crashArchive")
+	return a
+}
+
+// Tables of an App created from an AppConfig. Tables that aren't enabled by the AppConfig should be nil.
+type AppTables struct {
+	Count        CountTable
+	CountHistory CountHistoryTable
+	Crash        CrashTable
+}
+
+// Creates the tables for an App from it's AppConfig. Database and collection names are already filled in.
+type AppTablesFunc func(AppConfig) (AppTables, error)
+
+type configApp struct {
+	conf   AppConfig
+	tables AppTables
+}
+
+func (c *configApp) AppID() string {
+	return c.conf.ID
+}
+
+func (c *configApp) CountTable() CountTable {
+	return c.tables.Count
+}
+
+func (c *configApp) CrashTable() CrashTable {
+	return c.tables.Crash
+}
+
+func (c *configApp) CountHistoryTable() CountHistoryTable {
+	return c.tables.CountHistory
+}
+
+func (c *configApp) ShouldAddCrash(_ context.Context, cr IndividualCrash) bool {
+	return len(c.conf.AllowedVersions) == 0 || slices.Contains(c.conf.AllowedVersions, cr.Version)
+}
+
+type appConfigs struct {
+	mut     sync.Mutex
+	tables  AppTablesFunc
+	store   Table[AppConfig]
+	configs map[string]AppConfig
+}
+
+// Decode a JSON array of AppConfig, such as from a configuration file. Each AppConfig is validated.
+func LoadAppConfigs(r io.Reader) ([]AppConfig, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var out []AppConfig
+	err := dec.Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		err = Validate(out[i])
+		if err != nil {
+			return nil, fmt.Errorf("app %v: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+var (
+	getAppsDoc = RouteDoc{
+		Summary:     "Get all Apps",
+		Description: "Apps created from configuration include their AppConfig.",
+		Tags:        []string{"management"},
+		Permission:  "management",
+		Response:    ObjectSchema(map[string]any{"apps": []appInfo{}}),
+	}
+	addAppDoc = RouteDoc{
+		Summary:     "Add an App from it's configuration",
+		Description: "The App is available immediately and is saved so it's added again when the server restarts. API Keys for the App must still be created.",
+		Tags:        []string{"management"},
+		Permission:  "management",
+		Request:     AppConfig{},
+		Response:    AppConfig{},
+		Status:      http.StatusCreated,
+	}
+)
+
+// Enables Apps created from an AppConfig. tables is used to create each App's tables.
+// If store is not nil, the Apps in it are added and Apps added with POST /apps are saved to it.
+// Only the management key can use /apps.
+func (b *Backend) EnableAppConfig(ctx context.Context, tables AppTablesFunc, store Table[AppConfig]) error {
+	b.appConfigs.mut.Lock()
+	b.appConfigs.tables = tables
+	b.appConfigs.store = store
+	b.appConfigs.configs = make(map[string]AppConfig)
+	b.appConfigs.mut.Unlock()
+	b.m.HandleDoc("GET /apps", b.getApps, getAppsDoc)
+	b.m.HandleDoc("POST /apps", b.addApp, addAppDoc)
+	if store == nil {
+		return nil
+	}
+	confs, err := store.Find(ctx, map[string]any{})
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	for _, c := range confs {
+		err = b.AddAppConfig(c)
+		if err != nil {
+			return fmt.Errorf("app %v: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// Create an App from it's configuration and add it to the Backend. The AppConfig is not saved. EnableAppConfig must be called first.
+// Returns ErrDuplicateApp if the ID is already used by an App or the management key.
+func (b *Backend) AddAppConfig(conf AppConfig) error {
+	err := Validate(conf)
+	if err != nil {
+		return err
+	}
+	if !appIDRegex.MatchString(conf.ID) {
+		return ErrInvalidAppID
+	}
+	b.appConfigs.mut.Lock()
+	tablesFunc := b.appConfigs.tables
+	b.appConfigs.mut.Unlock()
+	if tablesFunc == nil {
+		return ErrAppConfigDisabled
+	}
+	if b.app(conf.ID) != nil || (b.managementKeyID != "" && conf.ID == b.managementKeyID) {
+		return ErrDuplicateApp
+	}
+	conf = conf.withDefaults()
+	tables, err := tablesFunc(conf)
+	if err != nil {
+		return err
+	}
+	if !conf.Count {
+		tables.Count = nil
+		tables.CountHistory = nil
+	}
+	if !conf.Crash {
+		tables.Crash = nil
+	}
+	err = b.AddApp(&configApp{conf: conf, tables: tables})
+	if err != nil {
+		return err
+	}
+	b.appConfigs.mut.Lock()
+	b.appConfigs.configs[conf.ID] = conf
+	b.appConfigs.mut.Unlock()
+	b.health.mut.Lock()
+	b.health.checked = time.Time{}
+	b.health.mut.Unlock()
+	slog.Info("added app from configuration", "app", conf.ID, "count", conf.Count, "crash", conf.Crash)
+	return nil
+}
+
+type appInfo struct {
+	ID     string     `json:"id"`
+	Count  bool       `json:"count"`
+	Crash  bool       `json:"crash"`
+	Config *AppConfig `json:"config,omitempty"`
+}
+
+func (b *Backend) getApps(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	if !b.isManagementKey(hdr.Key) {
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
+		return
+	}
+	b.appConfigs.mut.Lock()
+	defer b.appConfigs.mut.Unlock()
+	apps := b.appList()
+	out := make([]appInfo, len(apps))
+	for i, a := range apps {
+		out[i] = appInfo{
+			ID:    a.AppID(),
+			Count: a.CountTable() != nil,
+			Crash: a.CrashTable() != nil,
+		}
+		if conf, ok := b.appConfigs.configs[a.AppID()]; ok {
+			out[i].Config = &conf
+		}
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{"apps": out})
+}
+
+func (b *Backend) addApp(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	if !b.isManagementKey(hdr.Key) {
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
+		return
+	}
+	var conf AppConfig
+	if !DecodeJSON(w, r, &conf) {
+		return
+	}
+	if !appIDRegex.MatchString(conf.ID) {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request: id may only contain letters, numbers, - and _")
+		return
+	}
+	if b.app(conf.ID) != nil || (b.managementKeyID != "" && conf.ID == b.managementKeyID) {
+		WriteError(w, r, http.StatusConflict, CodeTaken, "App ID already used")
+		return
+	}
+	conf = conf.withDefaults()
+	b.appConfigs.mut.Lock()
+	store := b.appConfigs.store
+	b.appConfigs.mut.Unlock()
+	if store != nil {
+		err = store.Insert(r.Context(), conf)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error saving app config", "app", conf.ID, "err", err)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+			return
+		}
+	}
+	err = b.AddAppConfig(conf)
+	if err != nil {
+		if store != nil {
+			if rmErr := store.Remove(r.Context(), conf.ID); rmErr != nil {
+				slog.ErrorContext(r.Context(), "error removing app config after failing to add it", "app", conf.ID, "err", rmErr)
+			}
+		}
+		if err == ErrDuplicateApp {
+			WriteError(w, r, http.StatusConflict, CodeTaken, "App ID already used")
+			return
+		}
+		slog.ErrorContext(r.Context(), "error adding app from config", "app", conf.ID, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, conf)
+}
@@ -0,0 +1,177 @@
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum number of items in a single batch request.
+	MaxBatchSize = 100
+
+	maxCrashBatchBody = 8 << 20 // 8MB
+
+	// How far in the past an item's time can be. Older times are moved up to this.
+	maxQueuedAge = 30 * 24 * time.Hour
+)
+
+// The result of a single item in a batch request. ErrorCode and ErrorMsg are only populated on failure.
+type batchResult struct {
+	Status    int       `json:"status"`
+	ID        string    `json:"id,omitempty"`
+	ErrorCode ErrorCode `json:"errorCode,omitempty"`
+	ErrorMsg  string    `json:"errorMsg,omitempty"`
+}
+
+var (
+	countLogBatchDoc = RouteDoc{
+		Summary:     "Count multiple users",
+		Description: "Each item is handled like POST /count. Results are in the same order as the request.",
+		Tags:        []string{"count"},
+		Permission:  "count",
+		Request:     []countLogReq{},
+		Response:    ObjectSchema(map[string]any{"results": []batchResult{}}),
+	}
+	reportCrashBatchDoc = RouteDoc{
+		Summary:     "Report multiple crashes",
+		Description: "Each item is handled like POST /crash. Results are in the same order as the request.",
+		Tags:        []string{"crash"},
+		Permission:  "crash",
+		Request:     []crashReq{},
+		Response:    ObjectSchema(map[string]any{"results": []batchResult{}}),
+		MaxBody:     maxCrashBatchBody,
+	}
+)
+
+// Returns when a (possibly queued) item happened from it's client provided unix timestamp.
+// If unix is 0 the current time is used. Otherwise it's clamped between maxQueuedAge ago and now.
+func clientTime(unix int64) time.Time {
+	now := time.Now()
+	if unix == 0 {
+		return now
+	}
+	t := time.Unix(unix, 0)
+	if t.After(now) {
+		return now
+	}
+	if oldest := now.Add(-maxQueuedAge); t.Before(oldest) {
+		return oldest
+	}
+	return t
+}
+
+type gzipBody struct {
+	io.Reader
+	gz   *gzip.Reader
+	orig io.Closer
+}
+
+func (g gzipBody) Close() error {
+	g.gz.Close()
+	return g.orig.Close()
+}
+
+// Returns the request's body, transparently decompressing it if Content-Encoding is gzip.
+// Decompressed bodies are held to the same size limit as the compressed body.
+func requestBody(r *http.Request) (io.ReadCloser, error) {
+	if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return r.Body, nil
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		r.Body.Close()
+		return nil, err
+	}
+	out := gzipBody{Reader: gz, gz: gz, orig: r.Body}
+	if limit := bodyLimit(r); limit > 0 {
+		out.Reader = http.MaxBytesReader(nil, gz, limit)
+	}
+	return out, nil
+}
+
+// Decodes a JSON array from the request body. If the body is invalid or the array is empty or too large, an error response is written and false is returned.
+// Items are left undecoded so each item can be decoded with decodeBatchItem and fail separately.
+func decodeBatch(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, bool) {
+	var items []json.RawMessage
+	err := decodeJSON(r, &items)
+	if err != nil {
+		WriteBodyError(w, r, err)
+		return nil, false
+	}
+	if len(items) == 0 {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidBody, "Batch is empty")
+		return nil, false
+	}
+	if len(items) > MaxBatchSize {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, "Too many items in batch")
+		return nil, false
+	}
+	return items, true
+}
+
+// Strictly decodes a single batch item into v. Unknown fields are not allowed.
+// If the item is invalid, the item's failed result is returned.
+func decodeBatchItem(item json.RawMessage, v any) *batchResult {
+	dec := json.NewDecoder(bytes.NewReader(item))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &batchResult{Status: http.StatusBadRequest, ErrorCode: CodeInvalidBody, ErrorMsg: "Invalid request body: " + err.Error()}
+	}
+	return nil
+}
+
+func (b *Backend) reportCrashBatch(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "crash", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	items, ok := decodeBatch(w, r)
+	if !ok {
+		return
+	}
+	ap := b.GetApp(hdr.Key)
+	out := make([]batchResult, len(items))
+	for i := range items {
+		var req crashReq
+		if res := decodeBatchItem(items[i], &req); res != nil {
+			out[i] = *res
+			continue
+		}
+		out[i] = b.addCrash(r.Context(), ap, req)
+	}
+	WriteJSON(w, http.StatusOK, map[string][]batchResult{"results": out})
+}
+
+func (b *Backend) countLogBatch(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "count", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	items, ok := decodeBatch(w, r)
+	if !ok {
+		return
+	}
+	ap := b.GetApp(hdr.Key)
+	out := make([]batchResult, len(items))
+	for i := range items {
+		var req countLogReq
+		if res := decodeBatchItem(items[i], &req); res != nil {
+			out[i] = *res
+			continue
+		}
+		out[i] = b.addCount(r.Context(), ap, req)
+	}
+	WriteJSON(w, http.StatusOK, map[string][]batchResult{"results": out})
+}
@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCohortWeeks = 8
+	maxCohortWeeks     = 52
+)
+
+// A group of installs that were first seen in the same week.
+type Cohort struct {
+	Week string `json:"week"` // Monday of the week the installs were first seen, formatted as YYYY-MM-DD.
+	Size int    `json:"size"`
+	// Number of installs last seen during or after each week since the cohort's week. Retained[0] is always Size.
+	Retained []int `json:"retained"`
+}
+
+// The most weeks of cohorts that can be built for the App. Logs are removed after the App's retention period,
+// so cohorts starting before then would only contain installs that were active recently.
+func maxWeeks(ap App) int {
+	return max(min(int(logRetention(ap)/(7*24*time.Hour)), maxCohortWeeks), 1)
+}
+
+// Get the start (Monday) of t's week.
+func weekStart(t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// Get the number of weeks between the starts of two weeks. Rounded to account for daylight savings.
+func weeksBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / (24 * 7)))
+}
+
+// Builds weekly cohorts, starting at the week of start, from counts grouped by first and last seen date.
+func buildCohorts(counts []FirstSeenCount, start, now time.Time) []Cohort {
+	start = weekStart(start)
+	weeks := weeksBetween(start, weekStart(now)) + 1
+	out := make([]Cohort, weeks)
+	for i := range out {
+		out[i].Week = start.AddDate(0, 0, 7*i).Format(time.DateOnly)
+		out[i].Retained = make([]int, weeks-i)
+	}
+	for _, c := range counts {
+		cohort := weeksBetween(start, weekStart(dateToTime(c.FirstSeen)))
+		last := weeksBetween(start, weekStart(dateToTime(c.Date)))
+		// Logs created before first seen tracking have no FirstSeen.
+		if c.FirstSeen == 0 || cohort < 0 || cohort >= weeks {
+			continue
+		}
+		out[cohort].Size += c.Count
+		// An install last seen in a week was also active (retained) in every week before it.
+		for k := 0; k <= last-cohort && k < len(out[cohort].Retained); k++ {
+			out[cohort].Retained[k] += c.Count
+		}
+	}
+	return out
+}
+
+var getCohortsDoc = RouteDoc{
+	Summary:    "Get weekly retention cohorts",
+	Tags:       []string{"count"},
+	Permission: "management",
+	Query: []Param{
+		{Name: "weeks", Type: "integer", Description: "Number of weeks to include, up to 52 or the number of whole weeks in the App's log retention, whichever is less. Defaults to 8 or that maximum."},
+		{Name: "platform", Description: "Only include users of this platform. Defaults to all."},
+	},
+	Response: ObjectSchema(map[string]any{"platform": "", "cohorts": []Cohort{}}),
+}
+
+func (b *Backend) getCohorts(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	ap := b.countManagementApp(w, r, hdr)
+	if ap == nil {
+		return
+	}
+	maxW := maxWeeks(ap)
+	weeks := min(defaultCohortWeeks, maxW)
+	if q := r.URL.Query().Get("weeks"); q != "" {
+		weeks, err = strconv.Atoi(q)
+		if err != nil || weeks < 1 || weeks > maxW {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "weeks must be between 1 and "+strconv.Itoa(maxW))
+			return
+		}
+	}
+	platform := r.URL.Query().Get("platform")
+	if platform == "" {
+		platform = "all"
+	}
+	now := time.Now()
+	start := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	counts, err := ap.CountTable().CountByFirstSeen(r.Context(), getDate(start), platform)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting cohort counts", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"platform": platform,
+		"cohorts":  buildCohorts(counts, start, now),
+	})
+}
@@ -2,123 +2,183 @@ package backend
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 type CountLog struct {
-	ID       string `json:"id" bson:"_id"`
-	Platform string `json:"platform" bson:"platform"`
-	Date     int    `json:"date" bson:"date"`
+	ID        string `json:"id" bson:"_id"`
+	Platform  string `json:"platform" bson:"platform"`
+	Version   string `json:"version" bson:"version"`
+	OSVersion string `json:"osVersion" bson:"osVersion"`
+	Locale    string `json:"locale" bson:"locale"`
+	Date      int    `json:"date" bson:"date"`
+	FirstSeen int    `json:"firstSeen" bson:"firstSeen"`
 }
 
+// CountLog fields that GET /count can be broken down by.
+var countBreakdownFields = []string{"platform", "version", "osVersion", "locale"}
+
 func (c CountLog) GetID() string {
 	return c.ID
 }
 
 type countLogReq struct {
-	ID       string
-	Platform string
+	ID        string `json:"id" validate:"max=64"`
+	Platform  string `json:"platform" validate:"required,max=64"`
+	Version   string `json:"version" validate:"max=64"`
+	OSVersion string `json:"osVersion" validate:"max=64"`
+	Locale    string `json:"locale" validate:"max=64"`
+	// Unix timestamp (seconds) of when the ping happened. Used for pings that were queued while offline.
+	Time int64 `json:"time"`
 }
 
+var (
+	countLogDoc = RouteDoc{
+		Summary:     "Count a user",
+		Description: "Should be called once per app launch. If id is empty or not found, a new ID is created and should be used for future requests.",
+		Tags:        []string{"count"},
+		Permission:  "count",
+		Request:     countLogReq{},
+		Response:    ObjectSchema(map[string]any{"id": ""}),
+		Status:      http.StatusCreated,
+	}
+	getCountDoc = RouteDoc{
+		Summary:    "Get the current user count",
+		Tags:       []string{"count"},
+		Permission: "management",
+		Query: []Param{
+			{Name: "platform", Description: "Only count users of this platform. Defaults to all."},
+			{Name: "by", Description: "Break down the count by a field. Can be platform, version, osVersion, or locale."},
+		},
+		Response: ObjectSchema(map[string]any{"count": 0, "breakdown": map[string]int{}}),
+	}
+)
+
 func (b *Backend) countLog(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "count", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
-	defer r.Body.Close()
 	var req countLogReq
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil || req.Platform == "" {
-		if r.URL.Query().Get("platform") != "" {
-			//TODO: remove legacy code
-			req.Platform = r.URL.Query().Get("platform")
-			req.ID = r.URL.Query().Get("id")
-		} else {
-			ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	err = decodeJSON(r, &req)
+	if (err != nil || req.Platform == "") && r.URL.Query().Get("platform") != "" {
+		//TODO: remove legacy code
+		if !b.m.UseDeprecated(w, r, "POST /count?platform={platform}&id={id}", hdr.Key) {
+			WriteError(w, r, http.StatusGone, CodeGone, "Query parameters are no longer supported, use the request body instead")
 			return
 		}
+		req = countLogReq{
+			Platform: r.URL.Query().Get("platform"),
+			ID:       r.URL.Query().Get("id"),
+		}
+		err = nil
 	}
-	ap := b.GetApp(hdr.Key)
-	count := ap.CountTable()
-	if count == nil {
-		log.Println(ap.AppID(), "misconfigured: count table is nil.")
-		ReturnError(w, http.StatusInternalServerError, "misconfigured", "Server Misconfigured")
+	if err == nil {
+		err = Validate(req)
+	}
+	if err != nil {
+		WriteBodyError(w, r, err)
 		return
 	}
-	curDate := getDate(time.Now())
-	if req.ID == "" {
-		err = addToCountTable(r.Context(), w, count, req.Platform, curDate)
-		if err != nil {
-			log.Println("error adding to count table:", err)
-		}
+	res := b.addCount(r.Context(), b.GetApp(hdr.Key), req)
+	if res.ErrorCode != "" {
+		WriteError(w, r, res.Status, res.ErrorCode, res.ErrorMsg)
 		return
 	}
-	l, err := count.Get(r.Context(), req.ID)
-	if err == ErrNotFound {
-		err = addToCountTable(r.Context(), w, count, req.Platform, curDate)
+	WriteJSON(w, res.Status, map[string]string{"id": res.ID})
+}
+
+// Updates the CountLog with the request's ID. If the ID is empty or the CountLog is not found, a new CountLog is created.
+func (b *Backend) addCount(ctx context.Context, ap App, req countLogReq) batchResult {
+	if err := Validate(req); err != nil {
+		return batchResult{Status: http.StatusBadRequest, ErrorCode: CodeInvalidBody, ErrorMsg: "Invalid request: " + err.Error()}
+	}
+	count := ap.CountTable()
+	if count == nil {
+		slog.ErrorContext(ctx, "app misconfigured: count table is nil", "app", ap.AppID())
+		return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeMisconfigured, ErrorMsg: "Server Misconfigured"}
+	}
+	curDate := getDate(clientTime(req.Time))
+	var l CountLog
+	var err error
+	if req.ID != "" {
+		l, err = count.Get(ctx, req.ID)
+	}
+	if req.ID == "" || err == ErrNotFound {
+		var id string
+		id, err = addToCountTable(ctx, count, req, curDate)
 		if err != nil {
-			log.Println("error adding to count table:", err)
+			slog.ErrorContext(ctx, "error adding to count table", "err", err)
+			return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeInternal, ErrorMsg: "Server error"}
 		}
-		return
+		countPings.Inc(ap.AppID(), metricPlatform(req.Platform))
+		return batchResult{Status: http.StatusCreated, ID: id}
+	} else if err != nil {
+		slog.ErrorContext(ctx, "error getting count log", "err", err)
+		return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeInternal, ErrorMsg: "Server error"}
 	}
-	if l.Date >= curDate {
-		json.NewEncoder(w).Encode(map[string]string{"id": req.ID})
-		w.WriteHeader(http.StatusCreated)
-		return
+	upd := make(map[string]any)
+	if l.Date < curDate {
+		upd["date"] = curDate
 	}
-	err = count.PartUpdate(r.Context(), req.ID, map[string]any{"date": curDate})
-	if err != nil {
-		log.Println("error updating count log:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		return
+	if req.Version != "" && req.Version != l.Version {
+		upd["version"] = req.Version
+	}
+	if req.OSVersion != "" && req.OSVersion != l.OSVersion {
+		upd["osVersion"] = req.OSVersion
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": req.ID})
+	if req.Locale != "" && req.Locale != l.Locale {
+		upd["locale"] = req.Locale
+	}
+	if len(upd) > 0 {
+		err = count.PartUpdate(ctx, req.ID, upd)
+		if err != nil {
+			slog.ErrorContext(ctx, "error updating count log", "err", err)
+			return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeInternal, ErrorMsg: "Server error"}
+		}
+	}
+	countPings.Inc(ap.AppID(), metricPlatform(req.Platform))
+	return batchResult{Status: http.StatusCreated, ID: req.ID}
 }
 
-func addToCountTable(ctx context.Context, w http.ResponseWriter, c CountTable, platform string, curDate int) error {
+func addToCountTable(ctx context.Context, c CountTable, req countLogReq, curDate int) (string, error) {
 	id, err := uuid.NewV7()
 	if err != nil {
-		log.Println("error generating new log UUID:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		return err
+		return "", err
 	}
 	err = c.Insert(ctx, CountLog{
-		ID:       id.String(),
-		Platform: platform,
-		Date:     curDate,
+		ID:        id.String(),
+		Platform:  req.Platform,
+		Version:   req.Version,
+		OSVersion: req.OSVersion,
+		Locale:    req.Locale,
+		Date:      curDate,
+		FirstSeen: curDate,
 	})
-	if err != nil {
-		log.Println("error inserting new count log:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		return err
-	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": id.String()})
-	return nil
+	return id.String(), err
 }
 
 func (b *Backend) getCount(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", true)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
 	var ap App
-	if hdr.Key.AppID == b.managementKeyID {
-		ap = b.apps[r.PathValue("appID")]
+	if b.isManagementKey(hdr.Key) {
+		ap = b.app(r.PathValue("appID"))
 		if ap == nil {
-			ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 			return
 		}
 	} else {
@@ -126,14 +186,34 @@ func (b *Backend) getCount(w http.ResponseWriter, r *http.Request) {
 	}
 	count := ap.CountTable()
 	if count == nil {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Trying to get user count on app that doesn't have a count table")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Trying to get user count on app that doesn't have a count table")
 		return
 	}
-	out, err := count.Count(r.Context(), r.URL.Query().Get("platform"))
+	platform := r.URL.Query().Get("platform")
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		out, err := count.Count(r.Context(), platform)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error getting count", "err", err)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]int{"count": out})
+		return
+	}
+	if !slices.Contains(countBreakdownFields, by) {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "by must be one of: "+strings.Join(countBreakdownFields, ", "))
+		return
+	}
+	breakdown, err := count.CountBy(r.Context(), 0, platform, by)
 	if err != nil {
-		log.Println("error getting count:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error getting count breakdown", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]int{"count": out})
+	var total int
+	for _, c := range breakdown {
+		total += c
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{"count": total, "breakdown": breakdown})
 }
@@ -2,24 +2,153 @@ package backend
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 )
 
+const (
+	// Maximum number of CrashOccurrence kept per IndividualCrash. Older occurrences are dropped.
+	MaxCrashOccurrences = 10
+	// Maximum number of breadcrumbs kept per occurrence. If more are sent, only the latest are kept.
+	MaxBreadcrumbs = 50
+	// Maximum number of metadata entries per occurrence.
+	MaxMetadataEntries = 32
+	// Maximum length of a metadata key.
+	MaxMetadataKeyLength = 64
+	// Maximum length of a metadata value or breadcrumb message.
+	MaxMetadataValueLength = 1024
+)
+
+var (
+	ErrMetadataTooLarge = errors.New("crash metadata exceeds size limits")
+)
+
 type ArchivedCrash struct {
-	Error    string `json:"error" bson:"error"`
-	Stack    string `json:"stack" bson:"stack"`
-	Platform string `json:"platform" bson:"platform"`
+	Error    string `json:"error" bson:"error" validate:"required"`
+	Stack    string `json:"stack" bson:"stack" validate:"required"`
+	Platform string `json:"platform" bson:"platform" validate:"required,max=64"`
 }
 
 type IndividualCrash struct {
-	Platform string `json:"platform" bson:"platform"`
-	Version  string `json:"version" bson:"version"`
-	Error    string `json:"error" bson:"error"`
-	Stack    string `json:"stack" bson:"stack"`
-	Count    int    `json:"count" bson:"count"`
+	Platform    string            `json:"platform" bson:"platform"`
+	Version     string            `json:"version" bson:"version"`
+	Error       string            `json:"error" bson:"error"`
+	Stack       string            `json:"stack" bson:"stack"`
+	RawError    string            `json:"rawError,omitempty" bson:"rawError,omitempty"`
+	RawStack    string            `json:"rawStack,omitempty" bson:"rawStack,omitempty"`
+	Count       int               `json:"count" bson:"count"`
+	Occurrences []CrashOccurrence `json:"occurrences" bson:"occurrences,omitempty"`
+}
+
+type DeviceInfo struct {
+	Model        string `json:"model,omitempty" bson:"model,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty" bson:"manufacturer,omitempty"`
+	OS           string `json:"os,omitempty" bson:"os,omitempty"`
+	OSVersion    string `json:"osVersion,omitempty" bson:"osVersion,omitempty"`
+}
+
+type Breadcrumb struct {
+	Time     int64  `json:"time" bson:"time"`
+	Category string `json:"category,omitempty" bson:"category,omitempty"`
+	Message  string `json:"message" bson:"message"`
+}
+
+// A single occurrence of an IndividualCrash along with any extra info the client sent.
+// Only the latest MaxCrashOccurrences are stored.
+type CrashOccurrence struct {
+	Time        int64             `json:"time" bson:"time"`
+	Version     string            `json:"version" bson:"version"`
+	Build       string            `json:"build,omitempty" bson:"build,omitempty"`
+	Device      DeviceInfo        `json:"device" bson:"device"`
+	Breadcrumbs []Breadcrumb      `json:"breadcrumbs,omitempty" bson:"breadcrumbs,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+}
+
+// Trims breadcrumbs to the latest MaxBreadcrumbs and checks metadata against the size limits.
+func (o *CrashOccurrence) enforceLimits() error {
+	if len(o.Breadcrumbs) > MaxBreadcrumbs {
+		o.Breadcrumbs = o.Breadcrumbs[len(o.Breadcrumbs)-MaxBreadcrumbs:]
+	}
+	for i := range o.Breadcrumbs {
+		if len(o.Breadcrumbs[i].Message) > MaxMetadataValueLength {
+			o.Breadcrumbs[i].Message = o.Breadcrumbs[i].Message[:MaxMetadataValueLength]
+		}
+	}
+	if len(o.Metadata) > MaxMetadataEntries {
+		return ErrMetadataTooLarge
+	}
+	for k, v := range o.Metadata {
+		if len(k) > MaxMetadataKeyLength || len(v) > MaxMetadataValueLength {
+			return ErrMetadataTooLarge
+		}
+	}
+	return nil
+}
+
+type crashReq struct {
+	Platform    string            `json:"platform" validate:"required,max=64"`
+	Version     string            `json:"version" validate:"required,max=64"`
+	Error       string            `json:"error" validate:"required"`
+	Stack       string            `json:"stack" validate:"required"`
+	Build       string            `json:"build" validate:"max=64"`
+	Device      DeviceInfo        `json:"device"`
+	Breadcrumbs []Breadcrumb      `json:"breadcrumbs"`
+	Metadata    map[string]string `json:"metadata"`
+	// Unix timestamp (seconds) of when the crash happened. Used for crashes that were queued while offline.
+	Time int64 `json:"time"`
+}
+
+var (
+	reportCrashDoc = RouteDoc{
+		Summary:     "Report a crash",
+		Description: "Returns 201 if the crash was added, or 200 if the crash was ignored, such as if it was archived.",
+		Tags:        []string{"crash"},
+		Permission:  "crash",
+		Request:     crashReq{},
+		Response:    ObjectSchema(map[string]any{"added": false}),
+		Status:      http.StatusCreated,
+	}
+	getCrashDoc = RouteDoc{
+		Summary:    "Get a crash report",
+		Tags:       []string{"crash"},
+		Permission: "management",
+		Response:   CrashReport{},
+	}
+	deleteCrashDoc = RouteDoc{
+		Summary:    "Delete a crash report",
+		Tags:       []string{"crash"},
+		Permission: "management",
+		Response:   ObjectSchema(map[string]any{"id": ""}),
+	}
+	archiveCrashDoc = RouteDoc{
+		Summary:     "Archive a crash",
+		Description: "Crashes that exactly match an archived crash are ignored in the future.",
+		Tags:        []string{"crash"},
+		Permission:  "management",
+		Request:     ArchivedCrash{},
+		Response:    ObjectSchema(map[string]any{"removed": 0}),
+	}
+)
+
+func (c crashReq) toIndividual() (IndividualCrash, error) {
+	occ := CrashOccurrence{
+		Time:        clientTime(c.Time).Unix(),
+		Version:     c.Version,
+		Build:       c.Build,
+		Device:      c.Device,
+		Breadcrumbs: c.Breadcrumbs,
+		Metadata:    c.Metadata,
+	}
+	err := occ.enforceLimits()
+	return IndividualCrash{
+		Platform:    c.Platform,
+		Version:     c.Version,
+		Error:       c.Error,
+		Stack:       c.Stack,
+		Occurrences: []CrashOccurrence{occ},
+	}, err
 }
 
 type CrashReport struct {
@@ -37,154 +166,241 @@ func (b *Backend) reportCrash(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "crash", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
-	ap := b.GetApp(hdr.Key)
-	defer r.Body.Close()
-	var crash IndividualCrash
-	err = json.NewDecoder(r.Body).Decode(&crash)
-	if err != nil || crash.Platform == "" || crash.Version == "" || crash.Error == "" || crash.Stack == "" {
-		ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	var req crashReq
+	if !DecodeJSON(w, r, &req) {
+		return
+	}
+	res := b.addCrash(r.Context(), b.GetApp(hdr.Key), req)
+	if res.ErrorCode != "" {
+		WriteError(w, r, res.Status, res.ErrorCode, res.ErrorMsg)
 		return
 	}
+	WriteSuccess(w, res.Status, map[string]bool{"added": res.Status == http.StatusCreated})
+}
+
+// If the crash is archived. Crashes are only deobfuscated when they're added, so crashes added before their symbol map was uploaded
+// are stored, and archived, with their original values. Deobfuscated crashes are checked against both.
+func isArchived(ctx context.Context, tab CrashTable, crash IndividualCrash) bool {
+	if tab.IsArchived(ctx, crash) {
+		return true
+	}
+	if crash.RawStack == "" {
+		return false
+	}
+	crash.Error, crash.Stack = crash.RawError, crash.RawStack
+	return tab.IsArchived(ctx, crash)
+}
+
+// Validates the crash and adds it to the App's CrashTable. Crashes that are filtered or archived are not added, but are not considered an error.
+func (b *Backend) addCrash(ctx context.Context, ap App, req crashReq) batchResult {
+	if err := Validate(req); err != nil {
+		return batchResult{Status: http.StatusBadRequest, ErrorCode: CodeInvalidBody, ErrorMsg: "Invalid request: " + err.Error()}
+	}
+	crash, err := req.toIndividual()
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, ErrorCode: CodeInvalidBody, ErrorMsg: "Crash metadata is too large"}
+	}
 	if filter, ok := ap.(CrashFilterApp); ok {
-		if !filter.ShouldAddCrash(r.Context(), crash) {
-			return
+		if !filter.ShouldAddCrash(ctx, crash) {
+			return batchResult{Status: http.StatusOK}
 		}
 	}
 	tab := ap.CrashTable()
 	if tab == nil {
-		log.Printf("key %v has crash permission, but app does not have a crash table", hdr.Key.AppID)
-		ReturnError(w, http.StatusInternalServerError, "misconfigured", "Server misconfigured")
+		slog.ErrorContext(ctx, "key has crash permission, but app does not have a crash table", "app", ap.AppID())
+		return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeMisconfigured, ErrorMsg: "Server misconfigured"}
+	}
+	b.symbolicate(ctx, ap, &crash)
+	if isArchived(ctx, tab, crash) {
+		return batchResult{Status: http.StatusOK}
+	}
+	err = tab.InsertCrash(ctx, crash)
+	if err != nil {
+		slog.ErrorContext(ctx, "crash insertion error", "err", err)
+		return batchResult{Status: http.StatusInternalServerError, ErrorCode: CodeInternal, ErrorMsg: "Server error"}
+	}
+	crashInserts.Inc(ap.AppID())
+	return batchResult{Status: http.StatusCreated}
+}
+
+func (b *Backend) getCrash(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	crashID := r.PathValue("crashID")
+	if crashID == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 		return
 	}
-	if !tab.IsArchived(r.Context(), crash) {
-		err = tab.InsertCrash(r.Context(), crash)
+	b.actualCrashGet(w, r, b.GetApp(hdr.Key), crashID)
+}
+
+func (b *Backend) managementGetCrash(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
 		if err != nil {
-			log.Println("crash insertion error:", err)
-			ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-			return
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
-		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	crashID := r.PathValue("crashID")
+	if crashID == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+		return
+	}
+	appID := r.PathValue("appID")
+	ap := b.app(appID)
+	if ap == nil || appID == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+		return
+	}
+	b.actualCrashGet(w, r, ap, crashID)
+}
+
+func (b *Backend) actualCrashGet(w http.ResponseWriter, r *http.Request, ap App, crashID string) {
+	ctx := r.Context()
+	crash := ap.CrashTable()
+	if crash == nil {
+		slog.ErrorContext(ctx, "app misconfigured: crash table is nil", "app", ap.AppID())
+		WriteError(w, r, http.StatusInternalServerError, CodeMisconfigured, "Server Misconfigured")
+		return
+	}
+	rep, err := crash.Get(ctx, crashID)
+	if err == ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Crash not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "error getting crash", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
 	}
+	WriteJSON(w, http.StatusOK, rep)
 }
 
 func (b *Backend) deleteCrash(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
 	crashID := r.PathValue("crashID")
 	if crashID == "" {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 		return
 	}
-	b.actualCrashDelete(r.Context(), w, b.GetApp(hdr.Key), crashID)
+	b.actualCrashDelete(w, r, b.GetApp(hdr.Key), crashID)
 }
 
 func (b *Backend) managementDeleteCrash(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", true)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
 	crashID := r.PathValue("crashID")
 	if crashID == "" {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 		return
 	}
 	appID := r.PathValue("appID")
-	ap := b.apps[appID]
+	ap := b.app(appID)
 	if ap == nil || appID == "" {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 		return
 	}
-	b.actualCrashDelete(r.Context(), w, ap, crashID)
+	b.actualCrashDelete(w, r, ap, crashID)
 }
 
-func (b *Backend) actualCrashDelete(ctx context.Context, w http.ResponseWriter, ap App, crashID string) {
+func (b *Backend) actualCrashDelete(w http.ResponseWriter, r *http.Request, ap App, crashID string) {
+	ctx := r.Context()
 	crash := ap.CrashTable()
 	if crash == nil {
-		log.Println(ap.AppID(), "misconfigured: crash table is nil.")
-		ReturnError(w, http.StatusInternalServerError, "misconfigured", "Server Misconfigured")
+		slog.ErrorContext(ctx, "app misconfigured: crash table is nil", "app", ap.AppID())
+		WriteError(w, r, http.StatusInternalServerError, CodeMisconfigured, "Server Misconfigured")
 		return
 	}
 	err := crash.Remove(ctx, crashID)
 	if err != nil && err != ErrNotFound {
-		log.Println("error when deleting crash:", err)
+		slog.ErrorContext(ctx, "error when deleting crash", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
 	}
+	WriteSuccess(w, http.StatusOK, map[string]string{"id": crashID})
 }
 
 func (b *Backend) archiveCrash(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
-	defer r.Body.Close()
 	var toArchive ArchivedCrash
-	err = json.NewDecoder(r.Body).Decode(&toArchive)
-	if err != nil || toArchive.Platform == "" || toArchive.Error == "" || toArchive.Stack == "" {
-		ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	if !DecodeJSON(w, r, &toArchive) {
 		return
 	}
-	b.actualCrashArchive(r.Context(), w, b.GetApp(hdr.Key), toArchive)
+	b.actualCrashArchive(w, r, b.GetApp(hdr.Key), toArchive)
 }
 
 func (b *Backend) managementArchiveCrash(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", true)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
 	appID := r.PathValue("appID")
-	ap := b.apps[appID]
+	ap := b.app(appID)
 	if ap == nil || appID == "" {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
 		return
 	}
-	defer r.Body.Close()
 	var toArchive ArchivedCrash
-	err = json.NewDecoder(r.Body).Decode(&toArchive)
-	if err != nil || toArchive.Platform == "" || toArchive.Error == "" || toArchive.Stack == "" {
-		ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	if !DecodeJSON(w, r, &toArchive) {
 		return
 	}
-	b.actualCrashArchive(r.Context(), w, ap, toArchive)
+	b.actualCrashArchive(w, r, ap, toArchive)
 }
 
-func (b *Backend) actualCrashArchive(ctx context.Context, w http.ResponseWriter, ap App, toArchive ArchivedCrash) {
+func (b *Backend) actualCrashArchive(w http.ResponseWriter, r *http.Request, ap App, toArchive ArchivedCrash) {
+	ctx := r.Context()
 	crash := ap.CrashTable()
 	if crash == nil {
-		log.Println(ap.AppID(), "misconfigured: crash table is nil.")
-		ReturnError(w, http.StatusInternalServerError, "misconfigured", "Server Misconfigured")
+		slog.ErrorContext(ctx, "app misconfigured: crash table is nil", "app", ap.AppID())
+		WriteError(w, r, http.StatusInternalServerError, CodeMisconfigured, "Server Misconfigured")
 		return
 	}
 	err := crash.Archive(ctx, toArchive)
 	if err != nil {
-		log.Println("error archive crash:", err)
+		slog.ErrorContext(ctx, "error archive crash", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
 	first, _, _ := strings.Cut(toArchive.Stack, "\n")
 	crashes, err := crash.Find(ctx, map[string]any{"error": toArchive.Error, "firstLine": first})
 	if err == ErrNotFound {
+		WriteSuccess(w, http.StatusOK, map[string]int{"removed": 0})
 		return
 	} else if err != nil {
-		log.Println("error finding matching crashes:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(ctx, "error finding matching crashes", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
+	var removed int
 	for _, c := range crashes {
 		ogLen := len(c.Individual)
 		for i := 0; i < len(c.Individual); i++ {
@@ -196,16 +412,25 @@ func (b *Backend) actualCrashArchive(ctx context.Context, w http.ResponseWriter,
 				}
 			}
 		}
+		removed += ogLen - len(c.Individual)
 		if len(c.Individual) == 0 {
 			err = crash.Remove(ctx, c.ID)
 			if err != nil {
-				log.Println("error removing empty crash report:", err)
+				slog.ErrorContext(ctx, "error removing empty crash report", "err", err)
 			}
 		} else if len(c.Individual) < ogLen {
+			// Individual crashes reported before occurrences were kept don't have any.
+			// Writing them as null instead of an empty array would make adding future occurrences fail.
+			for i := range c.Individual {
+				if c.Individual[i].Occurrences == nil {
+					c.Individual[i].Occurrences = []CrashOccurrence{}
+				}
+			}
 			err = crash.PartUpdate(ctx, c.ID, map[string]any{"individual": c.Individual})
 			if err != nil {
-				log.Println("error updating individual crash reports:", err)
+				slog.ErrorContext(ctx, "error updating individual crash reports", "err", err)
 			}
 		}
 	}
+	WriteSuccess(w, http.StatusOK, map[string]int{"removed": removed})
 }
@@ -1,13 +1,12 @@
 package backend
 
 import (
-	"context"
 	"crypto/ed25519"
 	"embed"
-	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,88 +14,62 @@ import (
 //go:embed robots.txt
 var robotEmbed embed.FS
 
+var (
+	ErrDuplicateApp = errors.New("duplicate AppIDs found")
+	ErrEmptyAppID   = errors.New("AppID is empty")
+)
+
 // A simple backend that handles user authentication, user count, and crash reports.
 type Backend struct {
-	userTable       Table[User]
-	keyTable        Table[APIKey]
-	m               *http.ServeMux
-	apps            map[string]App
-	managementKeyID string
-	corsAddr        string
-	jwtPriv         ed25519.PrivateKey
-	jwtPub          ed25519.PublicKey
-	userCreateMutex sync.Mutex
+	userTable         Table[User]
+	keyTable          Table[APIKey]
+	configTable       Table[ConfigEntry]
+	announcementTable Table[Announcement]
+	m                 *Router
+	apps              map[string]App
+	appMut            sync.RWMutex
+	hasCount          bool
+	hasCrash          bool
+	hasVersions       bool
+	appConfigs        appConfigs
+	managementKeyID   string
+	corsAddr          string
+	jwtPriv           ed25519.PrivateKey
+	jwtPub            ed25519.PublicKey
+	userCreateMutex   sync.Mutex
+	cleanupTicker     *time.Ticker
+	cleanupMutex      sync.Mutex
+	lastCleanup       map[string]CleanupResult
+	health            healthChecks
 }
 
 // Create a new Backend with the given apps. keyTable must be specified.
 func NewBackend(keyTable Table[APIKey], apps ...App) (*Backend, error) {
 	b := &Backend{
 		keyTable:        keyTable,
-		m:               &http.ServeMux{},
+		m:               NewRouter(),
 		apps:            make(map[string]App),
 		userCreateMutex: sync.Mutex{},
+		cleanupTicker:   time.NewTicker(DefaultCleanupInterval),
+		lastCleanup:     make(map[string]CleanupResult),
 	}
 	b.m.Handle("GET /robots.txt", http.FileServerFS(robotEmbed))
-	var hasLog, hasCrash bool
+	b.m.HandleDoc("GET /healthz", b.healthz, healthzDoc)
+	b.m.HandleDoc("GET /readyz", b.readyz, readyzDoc)
+	b.m.HandleDoc("GET /openapi.json", b.openAPISpec, openAPIDoc)
+	b.m.HandleDoc("GET /deprecations", b.getDeprecations, getDeprecationsDoc)
 	for i := range apps {
-		_, has := b.apps[apps[i].AppID()]
-		if has {
-			return nil, errors.New("duplicate AppIDs found")
-		}
-		b.apps[apps[i].AppID()] = apps[i]
-		if ext, is := apps[i].(ExtendedApp); is {
-			ext.Extension(b.m)
-		}
-		if back, is := apps[i].(CallbackApp); is {
-			back.AddBackend(b)
-		}
-		if !hasLog && apps[i].CountTable() != nil {
-			hasLog = true
-		}
-		if !hasCrash && apps[i].CrashTable() != nil {
-			hasCrash = true
+		err := b.AddApp(apps[i])
+		if err != nil {
+			return nil, err
 		}
 	}
-	if hasLog {
-		b.m.HandleFunc("POST /count", b.countLog)
-		b.m.HandleFunc("GET /count", b.getCount)
-
-		//TODO: Remove legacy paths
-		b.m.HandleFunc("POST /log", b.countLog)
-	}
-	if hasCrash {
-		b.m.HandleFunc("POST /crash", b.reportCrash)
-		b.m.HandleFunc("DELETE /crash/{crashID}", b.deleteCrash)
-		b.m.HandleFunc("POST /crash/archive", b.archiveCrash)
-	}
 	b.m.HandleFunc("OPTIONS /", func(_ http.ResponseWriter, _ *http.Request) {}) //Here to send just CORS data.
 	go b.cleanupLoop()
+	go b.historyLoop()
 	return b, nil
 }
 
-func (b *Backend) cleanupLoop() {
-	b.cleanup()
-	for range time.Tick(24 * time.Hour) {
-		b.cleanup()
-	}
-}
-
-func (b *Backend) cleanup() {
-	old := getDate(time.Now().Add(-30 * 24 * time.Hour))
-	var err error
-	for _, a := range b.apps {
-		log.Printf("Removing logs for %v", a.AppID())
-		tab := a.CountTable()
-		if tab == nil {
-			continue
-		}
-		err = tab.RemoveOldLogs(context.Background(), old)
-		if err != nil {
-			log.Printf("error removing old logs for %v: %v\n", a.AppID(), err)
-		}
-	}
-}
-
 // Enable CORS for with the given cors address
 func (b *Backend) AddCorsAddress(corsAddr string) {
 	b.corsAddr = corsAddr
@@ -119,12 +92,27 @@ func getDate(t time.Time) int {
 	return (t.Year() * 10000) + (int(t.Month()) * 100) + t.Day()
 }
 
+// If the key is the management key. Always false if EnableManagementKey hasn't been called.
+func (b *Backend) isManagementKey(k *APIKey) bool {
+	return b.managementKeyID != "" && k.AppID == b.managementKeyID
+}
+
 // Enables the use of a management API key for crash and count.
+// Routes only meant for the management key, such as /apps, refuse every key until this is called.
 func (b *Backend) EnableManagementKey(managementID string) {
 	b.managementKeyID = managementID
-	b.m.HandleFunc("DELETE /{appID}/crash/{crashID}", b.managementDeleteCrash)
-	b.m.HandleFunc("POST /{appID}/crash/archive", b.managementArchiveCrash)
-	b.m.HandleFunc("GET /{appID}/count", b.getCount)
+	b.m.HandleDoc("GET /{appID}/crash/{crashID}", b.managementGetCrash, managementDoc(getCrashDoc))
+	b.m.HandleDoc("DELETE /{appID}/crash/{crashID}", b.managementDeleteCrash, managementDoc(deleteCrashDoc))
+	b.m.HandleDoc("POST /{appID}/crash/archive", b.managementArchiveCrash, managementDoc(archiveCrashDoc))
+	b.m.HandleDoc("POST /{appID}/crash/symbols", b.managementUploadSymbols, managementDoc(uploadSymbolsDoc))
+	b.m.handleAppResource("GET", "count", b.getCount, managementDoc(getCountDoc))
+	b.m.HandleDoc("GET /{appID}/count/history", b.getCountHistory, managementDoc(getCountHistoryDoc))
+	b.m.HandleDoc("GET /{appID}/count/cohort", b.getCohorts, managementDoc(getCohortsDoc))
+	b.m.HandleDoc("GET /{appID}/count/cleanup", b.getCleanup, managementDoc(getCleanupDoc))
+	b.m.HandleDoc("POST /{appID}/count/cleanup", b.runCleanup, managementDoc(runCleanupDoc))
+	b.m.handleAppResource("GET", "versions", b.managementGetVersions, managementDoc(getVersionsDoc))
+	b.m.handleAppResource("POST", "versions", b.managementAddVersion, managementDoc(addVersionDoc))
+	b.m.HandleDoc("POST /{appID}/versions/{version}/deprecate", b.managementDeprecateVersion, managementDoc(deprecateVersionDoc))
 }
 
 // Enables user creation and authentication.
@@ -132,9 +120,9 @@ func (b *Backend) AddUserAuth(userTable Table[User], privKey, pubKey []byte) {
 	b.userTable = userTable
 	b.jwtPriv = privKey
 	b.jwtPub = pubKey
-	b.m.HandleFunc("POST /user/create", b.createUser)
-	b.m.HandleFunc("DELETE /user/{userID}", b.deleteUser)
-	b.m.HandleFunc("POST /user/login", b.login)
+	b.m.HandleDoc("POST /user/create", b.createUser, createUserDoc)
+	b.m.HandleDoc("DELETE /user/{userID}", b.deleteUser, deleteUserDoc)
+	b.m.HandleDoc("POST /user/login", b.login, loginDoc)
 }
 
 // Add values to the Backend's underlying ServeMux
@@ -142,21 +130,94 @@ func (b *Backend) HandleFunc(pattern string, h http.HandlerFunc) {
 	b.m.HandleFunc(pattern, h)
 }
 
+// Add values to the Backend's underlying ServeMux along with it's documentation.
+func (b *Backend) HandleDoc(pattern string, h http.HandlerFunc, doc RouteDoc) {
+	b.m.HandleDoc(pattern, h, doc)
+}
+
+// Set the maximum size of request bodies in bytes for routes that don't set RouteDoc.MaxBody. Defaults to DefaultMaxBody.
+// Values <= 0 remove the limit.
+func (b *Backend) SetMaxBody(size int64) {
+	b.m.SetMaxBody(size)
+}
+
 // Try to get the App associated with the given ApiKey. Returns nil if not found.
 func (b *Backend) GetApp(a *APIKey) App {
-	return b.apps[a.AppID]
+	return b.app(a.AppID)
+}
+
+// Add an App to the Backend. Can be called after the Backend is serving requests.
+// Returns an error if an App with the same ID was already added.
+func (b *Backend) AddApp(ap App) error {
+	if ap.AppID() == "" {
+		return ErrEmptyAppID
+	}
+	b.appMut.Lock()
+	if _, has := b.apps[ap.AppID()]; has {
+		b.appMut.Unlock()
+		return ErrDuplicateApp
+	}
+	b.apps[ap.AppID()] = ap
+	addCount := !b.hasCount && ap.CountTable() != nil
+	addCrash := !b.hasCrash && ap.CrashTable() != nil
+	verApp, isVerApp := ap.(VersionApp)
+	addVersions := !b.hasVersions && isVerApp && verApp.VersionTable() != nil
+	b.hasCount = b.hasCount || addCount
+	b.hasCrash = b.hasCrash || addCrash
+	b.hasVersions = b.hasVersions || addVersions
+	b.appMut.Unlock()
+	if ext, is := ap.(ExtendedApp); is {
+		ext.Extension(b.m)
+	}
+	if back, is := ap.(CallbackApp); is {
+		back.AddBackend(b)
+	}
+	if addCount {
+		b.m.HandleDoc("POST /count", b.countLog, countLogDoc)
+		b.m.HandleDoc("POST /count/batch", b.countLogBatch, countLogBatchDoc)
+		b.m.HandleDoc("GET /count", b.getCount, getCountDoc)
+		b.m.HandleDoc("GET /count/history", b.getCountHistory, getCountHistoryDoc)
+		b.m.HandleDoc("GET /count/cohort", b.getCohorts, getCohortsDoc)
+		b.m.HandleDoc("GET /count/cleanup", b.getCleanup, getCleanupDoc)
+		b.m.HandleDoc("POST /count/cleanup", b.runCleanup, runCleanupDoc)
+
+		//TODO: Remove legacy paths
+		b.m.HandleDoc("POST /log", b.countLog, countLogDoc.Deprecate("/count"))
+	}
+	if addCrash {
+		b.m.HandleDoc("POST /crash", b.reportCrash, reportCrashDoc)
+		b.m.HandleDoc("POST /crash/batch", b.reportCrashBatch, reportCrashBatchDoc)
+		b.m.HandleDoc("GET /crash/{crashID}", b.getCrash, getCrashDoc)
+		b.m.HandleDoc("DELETE /crash/{crashID}", b.deleteCrash, deleteCrashDoc)
+		b.m.HandleDoc("POST /crash/archive", b.archiveCrash, archiveCrashDoc)
+		b.m.HandleDoc("POST /crash/symbols", b.uploadSymbols, uploadSymbolsDoc)
+	}
+	if addVersions {
+		b.m.HandleDoc("GET /versions", b.getVersions, getVersionsDoc)
+		b.m.HandleDoc("POST /versions", b.addVersion, addVersionDoc)
+		b.m.HandleDoc("POST /versions/{version}/deprecate", b.deprecateVersion, deprecateVersionDoc)
+		b.m.HandleDoc("GET /versions/supported", b.getSupportedVersions, supportedVersionsDoc)
+	}
+	return nil
 }
 
-type retError struct {
-	ErrorCode string `json:"errorCode"`
-	ErrorMsg  string `json:"errorMsg"`
+// Get the App with the given ID. Returns nil if not found.
+func (b *Backend) app(appID string) App {
+	b.appMut.RLock()
+	defer b.appMut.RUnlock()
+	return b.apps[appID]
 }
 
-// Return an error response with the given status code, code, and message.
-func ReturnError(w http.ResponseWriter, status int, code, msg string) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(retError{
-		ErrorCode: code,
-		ErrorMsg:  msg,
+// Get all Apps sorted by ID.
+func (b *Backend) appList() []App {
+	b.appMut.RLock()
+	defer b.appMut.RUnlock()
+	out := make([]App, 0, len(b.apps))
+	for _, a := range b.apps {
+		out = append(out, a)
+	}
+	slices.SortFunc(out, func(a, b App) int {
+		return strings.Compare(a.AppID(), b.AppID())
 	})
+	return out
 }
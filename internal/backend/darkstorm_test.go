@@ -1,8 +1,1136 @@
 package backend_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
 )
 
+// In memory Table so routes can be tested without a database.
+// Find only supports matching fields exactly, comparing against the item's JSON values.
+type memTable[T backend.IDStruct] struct {
+	mut   sync.Mutex
+	items map[string]T
+}
+
+func newMemTable[T backend.IDStruct](items ...T) *memTable[T] {
+	m := &memTable[T]{items: make(map[string]T)}
+	for _, i := range items {
+		m.items[i.GetID()] = i
+	}
+	return m
+}
+
+func (m *memTable[T]) Get(_ context.Context, ID string) (data T, err error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	data, has := m.items[ID]
+	if !has {
+		return data, backend.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memTable[T]) Find(_ context.Context, values map[string]any) ([]T, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	var out []T
+	for _, i := range m.items {
+		fields := jsonFields(i)
+		match := true
+		for k, v := range values {
+			if fmt.Sprint(fields[k]) != fmt.Sprint(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, i)
+		}
+	}
+	if len(out) == 0 {
+		return nil, backend.ErrNotFound
+	}
+	return out, nil
+}
+
+func (m *memTable[T]) Insert(_ context.Context, data T) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, has := m.items[data.GetID()]; has {
+		return fmt.Errorf("duplicate ID %v", data.GetID())
+	}
+	m.items[data.GetID()] = data
+	return nil
+}
+
+func (m *memTable[T]) Remove(_ context.Context, ID string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, has := m.items[ID]; !has {
+		return backend.ErrNotFound
+	}
+	delete(m.items, ID)
+	return nil
+}
+
+func (m *memTable[T]) FullUpdate(_ context.Context, ID string, data T) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, has := m.items[ID]; !has {
+		return backend.ErrNotFound
+	}
+	m.items[ID] = data
+	return nil
+}
+
+func (m *memTable[T]) PartUpdate(_ context.Context, ID string, update map[string]any) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	i, has := m.items[ID]
+	if !has {
+		return backend.ErrNotFound
+	}
+	fields := jsonFields(i)
+	for k, v := range update {
+		fields[k] = v
+	}
+	dat, _ := json.Marshal(fields)
+	var out T
+	err := json.Unmarshal(dat, &out)
+	if err != nil {
+		return err
+	}
+	m.items[ID] = out
+	return nil
+}
+
+func jsonFields(v any) map[string]any {
+	dat, _ := json.Marshal(v)
+	var out map[string]any
+	json.Unmarshal(dat, &out)
+	return out
+}
+
+type memCountTable struct {
+	*memTable[backend.CountLog]
+}
+
+func (m memCountTable) RemoveOldLogs(ctx context.Context, date int) (int, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	removed := 0
+	for id, l := range m.items {
+		if l.Date < date {
+			delete(m.items, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m memCountTable) CountOldLogs(ctx context.Context, date int) (int, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	old := 0
+	for _, l := range m.items {
+		if l.Date < date {
+			old++
+		}
+	}
+	return old, nil
+}
+
+func (m memCountTable) Count(ctx context.Context, platform string) (int, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	count := 0
+	for _, l := range m.items {
+		if platform == "" || platform == "all" || l.Platform == platform {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m memCountTable) CountBy(ctx context.Context, since int, platform, field string) (map[string]int, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	out := make(map[string]int)
+	for _, l := range m.items {
+		if l.Date < since || (platform != "" && platform != "all" && l.Platform != platform) {
+			continue
+		}
+		var val string
+		if field != "" {
+			val = fmt.Sprint(jsonFields(l)[field])
+		}
+		out[val]++
+	}
+	return out, nil
+}
+
+func (m memCountTable) CountByFirstSeen(ctx context.Context, since int, platform string) ([]backend.FirstSeenCount, error) {
+	return nil, nil
+}
+
+type memCrashTable struct {
+	*memTable[backend.CrashReport]
+	mut      sync.Mutex
+	archived []backend.ArchivedCrash
+	inserted []backend.IndividualCrash
+}
+
+func (m *memCrashTable) Archive(_ context.Context, a backend.ArchivedCrash) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.archived = append(m.archived, a)
+	return nil
+}
+
+func (m *memCrashTable) IsArchived(_ context.Context, ind backend.IndividualCrash) bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	for _, a := range m.archived {
+		if a.Error == ind.Error && a.Stack == ind.Stack && (a.Platform == ind.Platform || a.Platform == "all") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memCrashTable) InsertCrash(_ context.Context, ind backend.IndividualCrash) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.inserted = append(m.inserted, ind)
+	return nil
+}
+
+type testApp struct {
+	count    memCountTable
+	crash    *memCrashTable
+	versions *memTable[backend.Version]
+	symbols  *memTable[backend.SymbolMap]
+}
+
+func (t *testApp) AppID() string                                 { return "test" }
+func (t *testApp) CountTable() backend.CountTable                { return t.count }
+func (t *testApp) CrashTable() backend.CrashTable                { return t.crash }
+func (t *testApp) VersionTable() backend.Table[backend.Version]  { return t.versions }
+func (t *testApp) SymbolTable() backend.Table[backend.SymbolMap] { return t.symbols }
+
+const (
+	// Key for the test App with only client permissions.
+	clientKey = "client"
+	// Key for the test App with the management permission.
+	managementPermKey = "management"
+)
+
+// A Backend with a single App, test, and keys for it.
+func newTestBackend(t *testing.T) (*backend.Backend, *testApp) {
+	t.Helper()
+	ap := &testApp{
+		count:    memCountTable{newMemTable[backend.CountLog]()},
+		crash:    &memCrashTable{memTable: newMemTable[backend.CrashReport]()},
+		versions: newMemTable[backend.Version](),
+		symbols:  newMemTable[backend.SymbolMap](),
+	}
+	keys := newMemTable(
+		backend.APIKey{ID: clientKey, AppID: "test", Perm: map[string]bool{"count": true, "crash": true}},
+		backend.APIKey{ID: managementPermKey, AppID: "test", Perm: map[string]bool{"management": true}},
+	)
+	b, err := backend.NewBackend(keys, ap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, ap
+}
+
+func doRequest(h http.Handler, method, path, key string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// Requests that must be rejected for keys without the management permission.
+type permCase struct {
+	method, path, body string
+}
+
+// Checks that the client key is rejected and the management key is allowed for each request.
+func testManagementPerm(t *testing.T, h http.Handler, cases []permCase) {
+	t.Helper()
+	for _, c := range cases {
+		w := doRequest(h, c.method, c.path, clientKey, strings.NewReader(c.body))
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalidKey") {
+			t.Errorf("%v %v with client key: got %v %v, want 401 invalidKey", c.method, c.path, w.Code, w.Body.String())
+		}
+		w = doRequest(h, c.method, c.path, managementPermKey, strings.NewReader(c.body))
+		if w.Code == http.StatusUnauthorized {
+			t.Errorf("%v %v with management key: got 401 %v", c.method, c.path, w.Body.String())
+		}
+	}
+}
+
 func TestStuff(t *testing.T) {
 }
+
+func TestRemoteConfigPermission(t *testing.T) {
+	b, _ := newTestBackend(t)
+	b.EnableRemoteConfig(newMemTable[backend.ConfigEntry]())
+	testManagementPerm(t, b, []permCase{
+		{"GET", "/test/config/entries", ""},
+		{"POST", "/test/config/entries", `{"key":"newEditor","value":true}`},
+	})
+	// Clients can still get their config.
+	if w := doRequest(b, "GET", "/test/config", clientKey, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "newEditor") {
+		t.Errorf("client config: got %v %v", w.Code, w.Body.String())
+	}
+	testManagementPerm(t, b, []permCase{{"DELETE", "/test/config/entries/newEditor", ""}})
+}
+
+func TestDeobfuscate(t *testing.T) {
+	dart, err := backend.ParseSymbolMap(backend.SymbolFormatDart, strings.NewReader(`["CharacterEditor","aB","save","c"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := backend.ParseSymbolMap(backend.SymbolFormatMapping, strings.NewReader("# comment\nCharacterEditor -> aB\n\nsave -> c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack := "#0 aB.c (package:swassistant/a.dart:12)"
+	want := "#0 CharacterEditor.save (package:swassistant/a.dart:12)"
+	for _, syms := range [][]backend.Symbol{dart, mapping} {
+		if got := backend.Deobfuscate(stack, syms); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if _, err = backend.ParseSymbolMap(backend.SymbolFormatDart, strings.NewReader(`["odd"]`)); err != backend.ErrSymbolFormat {
+		t.Errorf("expected ErrSymbolFormat, got %v", err)
+	}
+}
+
+func TestDeobfuscateShortSymbols(t *testing.T) {
+	syms, err := backend.ParseSymbolMap(backend.SymbolFormatDart, strings.NewReader(`["CharacterEditor","a","save","b","Dice","c"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack := "#0      a.b (package:swassistant/a.dart:12:5)\n#1      c.<anonymous closure> (package:b/c.dart:3)\n<asynchronous suspension>\nat a.b(a.java:7)"
+	want := "#0      CharacterEditor.save (package:swassistant/a.dart:12:5)\n#1      Dice.<anonymous closure> (package:b/c.dart:3)\n<asynchronous suspension>\nat CharacterEditor.save(a.java:7)"
+	if got := backend.Deobfuscate(stack, syms); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	errMsg := "NoSuchMethodError: Class 'a' has no instance method 'b'. a b c"
+	want = "NoSuchMethodError: Class 'CharacterEditor' has no instance method 'save'. a b c"
+	if got := backend.Deobfuscate(errMsg, syms); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAnnouncementPermission(t *testing.T) {
+	b, _ := newTestBackend(t)
+	b.EnableAnnouncements(newMemTable[backend.Announcement]())
+	body := `{"title":"Maintenance","message":"Down for maintenance"}`
+	if w := doRequest(b, "POST", "/announcements", clientKey, strings.NewReader(body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("add with client key: got %v %v", w.Code, w.Body.String())
+	}
+	w := doRequest(b, "POST", "/announcements", managementPermKey, strings.NewReader(body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add with management key: got %v %v", w.Code, w.Body.String())
+	}
+	var ann backend.Announcement
+	json.Unmarshal(w.Body.Bytes(), &ann)
+	testManagementPerm(t, b, []permCase{{"GET", "/announcements/all", ""}})
+	// Clients can still get active announcements.
+	if w = doRequest(b, "GET", "/announcements", clientKey, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Maintenance") {
+		t.Errorf("client announcements: got %v %v", w.Code, w.Body.String())
+	}
+	testManagementPerm(t, b, []permCase{{"DELETE", "/announcements/" + ann.ID, ""}})
+	if w = doRequest(b, "GET", "/announcements", clientKey, nil); strings.Contains(w.Body.String(), "Maintenance") {
+		t.Errorf("announcement wasn't deleted: %v", w.Body.String())
+	}
+}
+
+func TestSymbolUploadPermission(t *testing.T) {
+	b, ap := newTestBackend(t)
+	testManagementPerm(t, b, []permCase{{"POST", "/crash/symbols?platform=android&version=1.0.0", `["CharacterEditor","a"]`}})
+	if _, err := ap.symbols.Get(context.Background(), backend.SymbolMapID("android", "1.0.0")); err != nil {
+		t.Errorf("symbol map wasn't uploaded with the management key: %v", err)
+	}
+}
+
+func TestCleanupPermission(t *testing.T) {
+	b, ap := newTestBackend(t)
+	// Wait for the startup cleanup so it doesn't remove the old log.
+	for i := 0; doRequest(b, "GET", "/count/cleanup", managementPermKey, nil).Code != http.StatusOK; i++ {
+		if i == 100 {
+			t.Fatal("startup cleanup didn't run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ap.count.Insert(context.Background(), backend.CountLog{ID: "old", Platform: "android", Date: 20000101})
+	if w := doRequest(b, "POST", "/count/cleanup", clientKey, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("cleanup with client key: got %v %v", w.Code, w.Body.String())
+	}
+	if _, err := ap.count.Get(context.Background(), "old"); err != nil {
+		t.Fatal("cleanup with client key removed logs")
+	}
+	testManagementPerm(t, b, []permCase{
+		{"GET", "/count/cleanup", ""},
+		{"POST", "/count/cleanup", ""},
+	})
+	if _, err := ap.count.Get(context.Background(), "old"); err != backend.ErrNotFound {
+		t.Error("cleanup with management key didn't remove old logs")
+	}
+}
+
+func TestVersionPermission(t *testing.T) {
+	b, ap := newTestBackend(t)
+	testManagementPerm(t, b, []permCase{
+		{"POST", "/versions", `{"version":"1.0.0"}`},
+		{"GET", "/versions", ""},
+	})
+	// Versions added before the versions API may have a different ID.
+	ap.versions.Insert(context.Background(), backend.Version{ID: "legacy", Version: "0.9.0"})
+	testManagementPerm(t, b, []permCase{
+		{"POST", "/versions/1.0.0/deprecate", ""},
+		{"POST", "/versions/0.9.0/deprecate", ""},
+	})
+	vers, _ := ap.versions.Find(context.Background(), map[string]any{})
+	if len(vers) != 2 {
+		t.Fatalf("expected 2 versions, got %v", vers)
+	}
+	for _, v := range vers {
+		if !v.Deprecated {
+			t.Errorf("version %v wasn't deprecated", v.Version)
+		}
+	}
+	// Clients can still check supported versions.
+	if w := doRequest(b, "GET", "/versions/supported", clientKey, nil); w.Code != http.StatusNotFound {
+		t.Errorf("supported versions with client key: got %v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestAppsRequireManagementKey(t *testing.T) {
+	keys := newMemTable(
+		backend.APIKey{ID: "empty", Perm: map[string]bool{"management": true}},
+		backend.APIKey{ID: "mgmt", AppID: "darkstorm", Perm: map[string]bool{"management": true}},
+	)
+	b, err := backend.NewBackend(keys, &testApp{count: memCountTable{newMemTable[backend.CountLog]()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.EnableAppConfig(context.Background(), func(backend.AppConfig) (backend.AppTables, error) {
+		return backend.AppTables{}, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"empty", "mgmt"} {
+		if w := doRequest(b, "GET", "/apps", key, nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s key without a management key set: got %d, want 401", key, w.Code)
+		}
+	}
+	b.EnableManagementKey("darkstorm")
+	if w := doRequest(b, "GET", "/apps", "empty", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("empty AppID key: got %d, want 401", w.Code)
+	}
+	if w := doRequest(b, "GET", "/apps", "mgmt", nil); w.Code != http.StatusOK {
+		t.Fatalf("management key: got %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+type validateNested struct {
+	Value string `json:"value" validate:"required"`
+}
+
+type validateReq struct {
+	Str     string           `json:"str" validate:"required,min=2,max=4"`
+	Slice   []string         `json:"slice" validate:"min=1,max=2"`
+	Num     int              `json:"num" validate:"min=1,max=10"`
+	Float   float64          `json:"float" validate:"max=1"`
+	Uint    uint             `json:"uint" validate:"required"`
+	Ptr     *string          `json:"ptr" validate:"max=3,oneof=a bb"`
+	NumPtr  *int             `json:"numPtr" validate:"required,min=5"`
+	Sev     string           `json:"sev" validate:"oneof=info warning"`
+	Nested  validateNested   `json:"nested"`
+	List    []validateNested `json:"list"`
+	Skipped string           `json:"-" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	valid := func() validateReq {
+		return validateReq{
+			Str:    "abc",
+			Slice:  []string{"a"},
+			Num:    5,
+			Float:  0.5,
+			Uint:   1,
+			NumPtr: num(5),
+			Nested: validateNested{Value: "v"},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(*validateReq)
+		want   map[string]string
+	}{
+		{"valid", func(*validateReq) {}, nil},
+		{"required string", func(v *validateReq) { v.Str = "" }, map[string]string{"str": "is required"}},
+		{"min string", func(v *validateReq) { v.Str = "a" }, map[string]string{"str": "must have at least 2 characters"}},
+		{"max string", func(v *validateReq) { v.Str = "abcde" }, map[string]string{"str": "must have at most 4 characters"}},
+		{"max string counts characters", func(v *validateReq) { v.Str = "éééé" }, nil},
+		{"min slice", func(v *validateReq) { v.Slice = nil }, map[string]string{"slice": "must have at least 1 items"}},
+		{"max slice", func(v *validateReq) { v.Slice = []string{"a", "b", "c"} }, map[string]string{"slice": "must have at most 2 items"}},
+		{"min int", func(v *validateReq) { v.Num = 0 }, map[string]string{"num": "must be at least 1"}},
+		{"max int", func(v *validateReq) { v.Num = 11 }, map[string]string{"num": "must be at most 10"}},
+		{"max float", func(v *validateReq) { v.Float = 1.5 }, map[string]string{"float": "must be at most 1"}},
+		{"required uint", func(v *validateReq) { v.Uint = 0 }, map[string]string{"uint": "is required"}},
+		{"nil pointer skips rules", func(v *validateReq) { v.Ptr = nil }, nil},
+		{"pointer oneof", func(v *validateReq) { v.Ptr = str("bb") }, nil},
+		{"pointer not oneof", func(v *validateReq) { v.Ptr = str("c") }, map[string]string{"ptr": "must be one of a, bb"}},
+		{"pointer max", func(v *validateReq) { v.Ptr = str("dddd") }, map[string]string{"ptr": "must have at most 3 characters"}},
+		{"required pointer", func(v *validateReq) { v.NumPtr = nil }, map[string]string{"numPtr": "is required"}},
+		{"pointer to zero value isn't empty", func(v *validateReq) { v.NumPtr = num(0) }, map[string]string{"numPtr": "must be at least 5"}},
+		{"min pointer", func(v *validateReq) { v.NumPtr = num(4) }, map[string]string{"numPtr": "must be at least 5"}},
+		{"oneof", func(v *validateReq) { v.Sev = "warning" }, nil},
+		{"oneof allows empty", func(v *validateReq) { v.Sev = "" }, nil},
+		{"not oneof", func(v *validateReq) { v.Sev = "critical" }, map[string]string{"sev": "must be one of info, warning"}},
+		{"nested", func(v *validateReq) { v.Nested.Value = "" }, map[string]string{"nested.value": "is required"}},
+		{"slice of structs", func(v *validateReq) {
+			v.List = []validateNested{{Value: "v"}, {}}
+		}, map[string]string{"list[1].value": "is required"}},
+		{"multiple fields", func(v *validateReq) {
+			v.Str = ""
+			v.Num = 20
+		}, map[string]string{"str": "is required", "num": "must be at most 10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := valid()
+			tt.modify(&v)
+			err := backend.Validate(&v)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			verr, ok := err.(*backend.ValidationError)
+			if !ok {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if fmt.Sprint(verr.Fields) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %v, want %v", verr.Fields, tt.want)
+			}
+		})
+	}
+	if err := backend.Validate((*validateReq)(nil)); err != nil {
+		t.Fatalf("nil pointer: %v", err)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		limit  int64
+		status int
+		want   string
+	}{
+		{"valid", `{"value":"v"}`, 0, http.StatusOK, ""},
+		{"unknown field", `{"value":"v","other":1}`, 0, http.StatusBadRequest, `unknown field \"other\"`},
+		{"trailing data", `{"value":"v"}{"value":"w"}`, 0, http.StatusBadRequest, "unexpected data after JSON body"},
+		{"trailing garbage", `{"value":"v"} x`, 0, http.StatusBadRequest, "invalidBody"},
+		{"trailing whitespace", "{\"value\":\"v\"}\n ", 0, http.StatusOK, ""},
+		{"invalid JSON", `{"value":`, 0, http.StatusBadRequest, "invalidBody"},
+		{"validation", `{"value":""}`, 0, http.StatusBadRequest, `"fields":{"value":"is required"}`},
+		{"too large", `{"value":"` + strings.Repeat("a", 100) + `"}`, 50, http.StatusRequestEntityTooLarge, `"limit":50`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.limit > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, tt.limit)
+			}
+			var v validateNested
+			if backend.DecodeJSON(w, r, &v) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Fatalf("body %s doesn't contain %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func getClientConfig(t *testing.T, h http.Handler, query string) map[string]json.RawMessage {
+	t.Helper()
+	w := doRequest(h, "GET", "/test/config?"+query, clientKey, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get config: got %v %v", w.Code, w.Body.String())
+	}
+	var out struct {
+		Config map[string]json.RawMessage `json:"config"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return out.Config
+}
+
+func TestConfigRollout(t *testing.T) {
+	b, _ := newTestBackend(t)
+	tab := newMemTable[backend.ConfigEntry]()
+	b.EnableRemoteConfig(tab)
+	setRollouts := func(first, second int) {
+		tab.FullUpdate(context.Background(), "first", backend.ConfigEntry{ID: "first", AppID: "test", Key: "first", Value: json.RawMessage("false"),
+			Rules: []backend.ConfigRule{{Rollout: &first, Value: json.RawMessage("true")}}})
+		tab.FullUpdate(context.Background(), "second", backend.ConfigEntry{ID: "second", AppID: "test", Key: "second", Value: json.RawMessage("false"),
+			Rules: []backend.ConfigRule{{Rollout: &second, Value: json.RawMessage("true")}}})
+	}
+	tab.Insert(context.Background(), backend.ConfigEntry{ID: "first"})
+	tab.Insert(context.Background(), backend.ConfigEntry{ID: "second"})
+	const installs = 500
+	// Installs that get the rule's value for each entry.
+	enabled := func() (first, second map[int]bool) {
+		first, second = make(map[int]bool), make(map[int]bool)
+		for i := range installs {
+			conf := getClientConfig(t, b, fmt.Sprintf("id=install-%d", i))
+			first[i] = string(conf["first"]) == "true"
+			second[i] = string(conf["second"]) == "true"
+		}
+		return
+	}
+	count := func(m map[int]bool) (n int) {
+		for _, v := range m {
+			if v {
+				n++
+			}
+		}
+		return
+	}
+	tests := []struct {
+		rollout  int
+		min, max int
+	}{
+		{0, 0, 0},
+		{10, installs * 5 / 100, installs * 15 / 100},
+		{50, installs * 40 / 100, installs * 60 / 100},
+		{100, installs, installs},
+	}
+	var prev map[int]bool
+	for _, tt := range tests {
+		setRollouts(tt.rollout, tt.rollout)
+		first, second := enabled()
+		if n := count(first); n < tt.min || n > tt.max {
+			t.Errorf("rollout %d: %d of %d installs enabled, want %d-%d", tt.rollout, n, installs, tt.min, tt.max)
+		}
+		// Buckets are stable, so asking again gives the same result.
+		if again, _ := enabled(); fmt.Sprint(again) != fmt.Sprint(first) {
+			t.Errorf("rollout %d: installs changed between requests", tt.rollout)
+		}
+		// Increasing a rollout only adds installs.
+		for i := range prev {
+			if prev[i] && !first[i] {
+				t.Errorf("rollout %d: install-%d was removed from the rollout", tt.rollout, i)
+			}
+		}
+		prev = first
+		if tt.rollout == 50 && fmt.Sprint(first) == fmt.Sprint(second) {
+			t.Errorf("rollout %d: different entries enabled for the same installs", tt.rollout)
+		}
+	}
+	// Clients without an ID only get rollouts of 100.
+	setRollouts(99, 100)
+	conf := getClientConfig(t, b, "")
+	if string(conf["first"]) != "false" || string(conf["second"]) != "true" {
+		t.Errorf("no id: got %s", conf)
+	}
+}
+
+func TestConfigTargeting(t *testing.T) {
+	b, _ := newTestBackend(t)
+	tab := newMemTable(backend.ConfigEntry{ID: "entry", AppID: "test", Key: "value", Value: json.RawMessage(`"default"`),
+		Rules: []backend.ConfigRule{
+			{Platforms: []string{"android"}, MinVersion: "1.2", MaxVersion: "2.0.0", Value: json.RawMessage(`"androidRange"`)},
+			{MinVersion: "3", Value: json.RawMessage(`"new"`)},
+			{Platforms: []string{"ios"}, Value: json.RawMessage(`"ios"`)},
+		}})
+	b.EnableRemoteConfig(tab)
+	tests := []struct {
+		platform, version string
+		want              string
+	}{
+		{"android", "1.2.0", "androidRange"},
+		{"android", "1.2", "androidRange"},
+		{"android", "1.10", "androidRange"},
+		{"android", "v1.5.3", "androidRange"},
+		{"android", "2.0", "androidRange"},
+		{"android", "2.0.0", "androidRange"},
+		{"android", "1.1.9", "default"},
+		{"android", "2.0.1", "default"},
+		{"android", "", "default"},
+		{"web", "1.5", "default"},
+		{"android", "3.0", "new"},
+		{"web", "10", "new"},
+		{"ios", "1.5", "ios"},
+		{"ios", "", "ios"},
+		{"", "", "default"},
+	}
+	for _, tt := range tests {
+		conf := getClientConfig(t, b, "platform="+tt.platform+"&version="+tt.version)
+		if got := string(conf["value"]); got != `"`+tt.want+`"` {
+			t.Errorf("platform %q version %q: got %s, want %q", tt.platform, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestAnnouncementTargeting(t *testing.T) {
+	ann := backend.Announcement{Platforms: []string{"android", "ios"}, MinVersion: "1.2", MaxVersion: "2.0"}
+	tests := []struct {
+		platform, version string
+		want              bool
+	}{
+		{"android", "1.2", true},
+		{"ios", "1.10.1", true},
+		{"android", "2.0.0", true},
+		{"android", "2.0.1", false},
+		{"android", "1.1", false},
+		{"android", "", false},
+		{"web", "1.5", false},
+		{"", "1.5", true},
+	}
+	for _, tt := range tests {
+		if got := ann.Targets(tt.platform, tt.version); got != tt.want {
+			t.Errorf("Targets(%q, %q) = %v, want %v", tt.platform, tt.version, got, tt.want)
+		}
+	}
+	if !(backend.Announcement{}).Targets("web", "") {
+		t.Error("announcement without targeting should target every client")
+	}
+
+	now := time.Unix(1000, 0)
+	active := []struct {
+		start, end int64
+		want       bool
+	}{
+		{1000, 0, true},
+		{1001, 0, false},
+		{0, 1001, true},
+		{0, 1000, false},
+	}
+	for _, tt := range active {
+		if got := (backend.Announcement{Start: tt.start, End: tt.end}).ActiveAt(now); got != tt.want {
+			t.Errorf("ActiveAt with start %d and end %d = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+
+	b, _ := newTestBackend(t)
+	b.EnableAnnouncements(newMemTable(
+		backend.Announcement{ID: "android", Title: "Android only", Platforms: []string{"android"}, MinVersion: "2"},
+		backend.Announcement{ID: "everyone", Title: "Everyone"},
+		backend.Announcement{ID: "future", Title: "Future", Start: time.Now().Add(time.Hour).Unix()},
+	))
+	routes := []struct {
+		query    string
+		want     []string
+		excluded []string
+	}{
+		{"platform=android&version=2.1", []string{"Android only", "Everyone"}, []string{"Future"}},
+		{"platform=android&version=1.9", []string{"Everyone"}, []string{"Android only", "Future"}},
+		{"platform=ios&version=2.1", []string{"Everyone"}, []string{"Android only", "Future"}},
+	}
+	for _, tt := range routes {
+		body := doRequest(b, "GET", "/announcements?"+tt.query, clientKey, nil).Body.String()
+		for _, title := range tt.want {
+			if !strings.Contains(body, title) {
+				t.Errorf("%s: missing %q: %s", tt.query, title, body)
+			}
+		}
+		for _, title := range tt.excluded {
+			if strings.Contains(body, title) {
+				t.Errorf("%s: unexpected %q: %s", tt.query, title, body)
+			}
+		}
+	}
+}
+
+type memHistoryTable struct {
+	*memTable[backend.CountSnapshot]
+}
+
+func (m memHistoryTable) SnapshotsBetween(ctx context.Context, from, to int) ([]backend.CountSnapshot, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	var out []backend.CountSnapshot
+	for _, s := range m.items {
+		if s.Date >= from && s.Date <= to {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, backend.ErrNotFound
+	}
+	return out, nil
+}
+
+// A testApp that keeps count history and sets it's retention.
+type historyApp struct {
+	*testApp
+	history   memHistoryTable
+	retention time.Duration
+}
+
+func (h historyApp) CountHistoryTable() backend.CountHistoryTable {
+	return h.history
+}
+
+func (h historyApp) LogRetention() time.Duration {
+	return h.retention
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	now := time.Now()
+	date := func(daysAgo int) int {
+		d := now.AddDate(0, 0, -daysAgo)
+		return d.Year()*10000 + int(d.Month())*100 + d.Day()
+	}
+	logs := []backend.CountLog{
+		{ID: "today", Platform: "android", Date: date(0)},
+		{ID: "week", Platform: "ios", Date: date(5)},
+		{ID: "month", Platform: "android", Date: date(20)},
+	}
+	tests := []struct {
+		name      string
+		retention time.Duration
+		want      backend.ActiveUsers
+		partial   bool
+	}{
+		{"default retention", backend.DefaultLogRetention, backend.ActiveUsers{Daily: 1, Weekly: 2, Monthly: 3}, false},
+		{"retention shorter then a month", 10 * 24 * time.Hour, backend.ActiveUsers{Daily: 1, Weekly: 2, Monthly: 2}, true},
+		{"retention shorter then a week", 3 * 24 * time.Hour, backend.ActiveUsers{Daily: 1, Weekly: 1, Monthly: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ap := historyApp{
+				testApp: &testApp{
+					count:    memCountTable{newMemTable(logs...)},
+					crash:    &memCrashTable{memTable: newMemTable[backend.CrashReport]()},
+					versions: newMemTable[backend.Version](),
+					symbols:  newMemTable[backend.SymbolMap](),
+				},
+				history:   memHistoryTable{newMemTable[backend.CountSnapshot]()},
+				retention: tt.retention,
+			}
+			b, err := backend.NewBackend(newMemTable(
+				backend.APIKey{ID: managementPermKey, AppID: "test", Perm: map[string]bool{"management": true}},
+			), ap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The first snapshot is created in the background when the Backend is created.
+			var res struct {
+				History []backend.CountSnapshot `json:"history"`
+			}
+			for range 100 {
+				w := doRequest(b, "GET", "/count/history", managementPermKey, nil)
+				json.Unmarshal(w.Body.Bytes(), &res)
+				if len(res.History) > 0 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if len(res.History) != 1 {
+				t.Fatalf("got %d snapshots, want 1", len(res.History))
+			}
+			snap := res.History[0]
+			if snap.Total != tt.want || snap.Partial != tt.partial {
+				t.Errorf("got %+v partial %v, want %+v partial %v", snap.Total, snap.Partial, tt.want, tt.partial)
+			}
+		})
+	}
+}
+
+func TestPersistDeprecatedUsage(t *testing.T) {
+	tab := newMemTable[backend.DeprecatedUsage]()
+	legacyCount := func(b *backend.Backend) {
+		t.Helper()
+		if w := doRequest(b, "POST", "/count?platform=android&id=legacy", clientKey, nil); w.Code != http.StatusCreated && w.Code != http.StatusOK {
+			t.Fatalf("legacy count: got %v %v", w.Code, w.Body.String())
+		}
+	}
+	// Usage is saved in the background.
+	waitForCount := func(count int) {
+		t.Helper()
+		for range 100 {
+			saved, _ := tab.Find(context.Background(), map[string]any{})
+			if len(saved) == 1 && saved[0].Count == count {
+				if saved[0].Key != clientKey || saved[0].AppID != "test" {
+					t.Fatalf("unexpected saved usage: %+v", saved[0])
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("usage with count %d wasn't saved", count)
+	}
+	deprecations := func(b *backend.Backend) (persisted bool, total int) {
+		t.Helper()
+		var res struct {
+			Persisted bool                      `json:"persisted"`
+			Routes    []backend.DeprecatedRoute `json:"routes"`
+		}
+		json.Unmarshal(doRequest(b, "GET", "/deprecations", managementPermKey, nil).Body.Bytes(), &res)
+		for _, route := range res.Routes {
+			total += route.Total
+		}
+		return res.Persisted, total
+	}
+
+	b, _ := newTestBackend(t)
+	legacyCount(b)
+	if persisted, total := deprecations(b); persisted || total != 1 {
+		t.Fatalf("without a table: got persisted %v total %v", persisted, total)
+	}
+	// Usage from before the table is set is saved as well.
+	if err := b.PersistDeprecatedUsage(context.Background(), tab); err != nil {
+		t.Fatal(err)
+	}
+	waitForCount(1)
+	legacyCount(b)
+	waitForCount(2)
+
+	// Usage is loaded after a restart and added to.
+	b, _ = newTestBackend(t)
+	if err := b.PersistDeprecatedUsage(context.Background(), tab); err != nil {
+		t.Fatal(err)
+	}
+	if persisted, total := deprecations(b); !persisted || total != 2 {
+		t.Fatalf("after restart: got persisted %v total %v", persisted, total)
+	}
+	legacyCount(b)
+	waitForCount(3)
+}
+
+func TestArchiveDeobfuscatedCrash(t *testing.T) {
+	b, ap := newTestBackend(t)
+	const (
+		rawErr   = "NoSuchMethodError: Class 'aB' has no instance method 'c'"
+		rawStack = "#0 aB.c (package:swassistant/a.dart:12)"
+		deobErr  = "NoSuchMethodError: Class 'CharacterEditor' has no instance method 'save'"
+		deobStk  = "#0 CharacterEditor.save (package:swassistant/a.dart:12)"
+	)
+	// Reported before the symbol map was uploaded.
+	ap.crash.Insert(context.Background(), backend.CrashReport{ID: "raw", Error: rawErr, FirstLine: rawStack,
+		Individual: []backend.IndividualCrash{{Platform: "android", Version: "1.0.0", Error: rawErr, Stack: rawStack, Count: 1}}})
+	if w := doRequest(b, "POST", "/crash/symbols?platform=android&version=1.0.0", managementPermKey,
+		strings.NewReader(`["CharacterEditor","aB","save","c"]`)); w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("upload symbols: got %v %v", w.Code, w.Body.String())
+	}
+	reportCrash := func() int {
+		body, _ := json.Marshal(map[string]string{"platform": "android", "version": "1.0.0", "error": rawErr, "stack": rawStack})
+		return doRequest(b, "POST", "/crash", clientKey, strings.NewReader(string(body))).Code
+	}
+
+	// Crashes are returned as they're stored.
+	var rep backend.CrashReport
+	json.Unmarshal(doRequest(b, "GET", "/crash/raw", managementPermKey, nil).Body.Bytes(), &rep)
+	if len(rep.Individual) != 1 || rep.Individual[0].Stack != rawStack || rep.Individual[0].RawStack != "" {
+		t.Fatalf("stored crash was changed when read: %+v", rep)
+	}
+
+	// New crashes are deobfuscated when added.
+	if code := reportCrash(); code != http.StatusCreated {
+		t.Fatalf("report crash: got %v", code)
+	}
+	if ins := ap.crash.inserted; len(ins) != 1 || ins[0].Stack != deobStk || ins[0].Error != deobErr || ins[0].RawStack != rawStack {
+		t.Fatalf("crash wasn't deobfuscated when added: %+v", ins)
+	}
+
+	// Archiving with the values returned by GET removes the stored crash and ignores new crashes, even though they're deobfuscated.
+	ind := rep.Individual[0]
+	body, _ := json.Marshal(backend.ArchivedCrash{Error: ind.Error, Stack: ind.Stack, Platform: "android"})
+	w := doRequest(b, "POST", "/crash/archive", managementPermKey, strings.NewReader(string(body)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":1`) {
+		t.Fatalf("archive stored crash: got %v %v", w.Code, w.Body.String())
+	}
+	if _, err := ap.crash.Get(context.Background(), "raw"); err != backend.ErrNotFound {
+		t.Errorf("archived crash wasn't removed: %v", err)
+	}
+	if code := reportCrash(); code != http.StatusOK {
+		t.Errorf("crash matching an archived crash: got %v, want 200", code)
+	}
+
+	// Crashes stored deobfuscated are archived with their deobfuscated values.
+	ap.crash.archived = nil
+	ap.crash.Insert(context.Background(), backend.CrashReport{ID: "deob", Error: deobErr, FirstLine: deobStk,
+		Individual: []backend.IndividualCrash{{Platform: "android", Version: "1.0.0", Error: deobErr, Stack: deobStk, RawError: rawErr, RawStack: rawStack, Count: 1}}})
+	body, _ = json.Marshal(backend.ArchivedCrash{Error: deobErr, Stack: deobStk, Platform: "all"})
+	w = doRequest(b, "POST", "/crash/archive", managementPermKey, strings.NewReader(string(body)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":1`) {
+		t.Fatalf("archive deobfuscated crash: got %v %v", w.Code, w.Body.String())
+	}
+	if code := reportCrash(); code != http.StatusOK {
+		t.Errorf("crash matching an archived deobfuscated crash: got %v, want 200", code)
+	}
+}
+
+func gzipBody(t *testing.T, body string) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+type batchResponse struct {
+	Results []struct {
+		Status    int    `json:"status"`
+		ID        string `json:"id"`
+		ErrorCode string `json:"errorCode"`
+	} `json:"results"`
+}
+
+func TestCountBatch(t *testing.T) {
+	b, ap := newTestBackend(t)
+	now := time.Now()
+	date := func(d time.Time) int {
+		return d.Year()*10000 + int(d.Month())*100 + d.Day()
+	}
+	body := fmt.Sprintf(`[
+		{"platform":"android"},
+		{"platform":"android","time":%d},
+		{"platform":"ios","time":%d},
+		{"platform":"web","time":%d},
+		{"platform":"android","unknown":true},
+		{"version":"1.0.0"}
+	]`, now.AddDate(0, 0, -3).Unix(), now.AddDate(0, 0, -60).Unix(), now.AddDate(0, 0, 5).Unix())
+	r := httptest.NewRequest("POST", "/count/batch", gzipBody(t, body))
+	r.Header.Set("X-API-Key", clientKey)
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("gzip batch: got %v %v", w.Code, w.Body.String())
+	}
+	var res batchResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	wantStatus := []int{201, 201, 201, 201, 400, 400}
+	if len(res.Results) != len(wantStatus) {
+		t.Fatalf("got %d results, want %d: %s", len(res.Results), len(wantStatus), w.Body.String())
+	}
+	for i, want := range wantStatus {
+		if res.Results[i].Status != want {
+			t.Errorf("item %d: got status %d, want %d", i, res.Results[i].Status, want)
+		}
+		if want == 400 && (res.Results[i].ErrorCode != "invalidBody" || res.Results[i].ID != "") {
+			t.Errorf("item %d: got %+v, want an invalidBody error", i, res.Results[i])
+		}
+	}
+	// Times are clamped to between 30 days ago and now.
+	wantDates := []int{date(now), date(now.AddDate(0, 0, -3)), date(now.Add(-30 * 24 * time.Hour)), date(now)}
+	for i, want := range wantDates {
+		l, err := ap.count.Get(context.Background(), res.Results[i].ID)
+		if err != nil {
+			t.Fatalf("item %d wasn't added: %v", i, err)
+		}
+		if l.Date != want {
+			t.Errorf("item %d: got date %d, want %d", i, l.Date, want)
+		}
+	}
+
+	items := func(n int) string {
+		return "[" + strings.TrimSuffix(strings.Repeat(`{"platform":"android"},`, n), ",") + "]"
+	}
+	tests := []struct {
+		name   string
+		body   io.Reader
+		gzip   bool
+		status int
+		code   string
+	}{
+		{"max items", strings.NewReader(items(backend.MaxBatchSize)), false, http.StatusOK, ""},
+		{"too many items", strings.NewReader(items(backend.MaxBatchSize + 1)), false, http.StatusRequestEntityTooLarge, "tooLarge"},
+		{"empty", strings.NewReader("[]"), false, http.StatusBadRequest, "invalidBody"},
+		{"not an array", strings.NewReader(`{"platform":"android"}`), false, http.StatusBadRequest, "invalidBody"},
+		{"invalid gzip", strings.NewReader(items(1)), true, http.StatusBadRequest, "invalidBody"},
+		{"decompressed too large", gzipBody(t, "["+strings.Repeat(" ", backend.DefaultMaxBody)+"]"), true, http.StatusRequestEntityTooLarge, "tooLarge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/count/batch", tt.body)
+			r.Header.Set("X-API-Key", clientKey)
+			if tt.gzip {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			b.ServeHTTP(w, r)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+				t.Errorf("got %v %v, want %v %v", w.Code, w.Body.String(), tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestCrashBatch(t *testing.T) {
+	b, ap := newTestBackend(t)
+	now := time.Now()
+	body := fmt.Sprintf(`[
+		{"platform":"android","version":"1.0.0","error":"err","stack":"#0 main","time":%d},
+		{"platform":"android","version":"1.0.0","error":"err","stack":"#0 main","time":%d},
+		{"platform":"android","version":"1.0.0","error":"err"},
+		{"platform":"android","version":"1.0.0","error":"err","stack":"#0 main","extra":1},
+		{"platform":"android","version":"1.0.0","error":"err","stack":"#0 main","metadata":{"key":%q}}
+	]`, now.AddDate(0, 0, -2).Unix(), now.AddDate(0, 0, -40).Unix(), strings.Repeat("a", backend.MaxMetadataValueLength+1))
+	w := doRequest(b, "POST", "/crash/batch", clientKey, strings.NewReader(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch: got %v %v", w.Code, w.Body.String())
+	}
+	var res batchResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	wantStatus := []int{201, 201, 400, 400, 400}
+	if len(res.Results) != len(wantStatus) {
+		t.Fatalf("got %d results, want %d: %s", len(res.Results), len(wantStatus), w.Body.String())
+	}
+	for i, want := range wantStatus {
+		if res.Results[i].Status != want {
+			t.Errorf("item %d: got status %d, want %d", i, res.Results[i].Status, want)
+		}
+	}
+	if len(ap.crash.inserted) != 2 {
+		t.Fatalf("got %d crashes added, want 2", len(ap.crash.inserted))
+	}
+	// Times are clamped to between 30 days ago and now.
+	wantTimes := []int64{now.AddDate(0, 0, -2).Unix(), now.Add(-30 * 24 * time.Hour).Unix()}
+	for i, want := range wantTimes {
+		got := ap.crash.inserted[i].Occurrences[0].Time
+		if got < want-5 || got > want+5 {
+			t.Errorf("crash %d: got time %d, want %d", i, got, want)
+		}
+	}
+}
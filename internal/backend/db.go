@@ -24,10 +24,32 @@ type Table[T IDStruct] interface {
 
 type CountTable interface {
 	Table[CountLog]
-	// Remove all Log items that have a CountLog.Date value less then the given value.
-	RemoveOldLogs(ctx context.Context, date int) error
+	// Remove all Log items that have a CountLog.Date value less then the given value. Returns the number of logs removed.
+	RemoveOldLogs(ctx context.Context, date int) (int, error)
+	// Get the number of Log items that have a CountLog.Date value less then the given value.
+	CountOldLogs(ctx context.Context, date int) (int, error)
 	// Get count. If platform is an empty string or "all", the full count should be given
 	Count(ctx context.Context, platform string) (int, error)
+	// Get the number of logs with a CountLog.Date value greater then or equal to since, grouped by the value of the given CountLog field.
+	// If field is an empty string, all logs are grouped under an empty string key.
+	// If platform is an empty string or "all", logs from all platforms are counted.
+	CountBy(ctx context.Context, since int, platform, field string) (map[string]int, error)
+	// Get the number of logs with a CountLog.FirstSeen value greater then or equal to since, grouped by their CountLog.FirstSeen and CountLog.Date values.
+	// Logs without a FirstSeen value (created before it was tracked) must not be counted.
+	// If platform is an empty string or "all", logs from all platforms are counted.
+	CountByFirstSeen(ctx context.Context, since int, platform string) ([]FirstSeenCount, error)
+}
+
+type FirstSeenCount struct {
+	FirstSeen int `bson:"firstSeen"`
+	Date      int `bson:"date"`
+	Count     int `bson:"count"`
+}
+
+type CountHistoryTable interface {
+	Table[CountSnapshot]
+	// Get the snapshots with a CountSnapshot.Date value between from and to, inclusive. Returns ErrNotFound if there are none.
+	SnapshotsBetween(ctx context.Context, from, to int) ([]CountSnapshot, error)
 }
 
 type CrashTable interface {
@@ -37,5 +59,6 @@ type CrashTable interface {
 	IsArchived(context.Context, IndividualCrash) bool
 	// Add the IndividualCrash report to the crash table. If a CrashReport exists that matches, then it gets added to CrashReport.Individual.
 	// If an IndividualCrash exists that is a perfect match, Count is incremented instead of adding it to the array.
+	// Any IndividualCrash.Occurrences are appended to the existing occurrences, only keeping the latest MaxCrashOccurrences.
 	InsertCrash(context.Context, IndividualCrash) error
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/CalebQ42/darkstorm-server/internal/backend"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type MongoTable[T backend.IDStruct] struct {
@@ -71,12 +72,23 @@ func (m *MongoTable[T]) PartUpdate(ctx context.Context, ID string, update map[st
 	return res.Err()
 }
 
-func (m *MongoTable[CountLog]) RemoveOldLogs(ctx context.Context, date int) error {
-	_, err := m.col.DeleteMany(ctx, bson.M{"date": bson.M{"$lt": date}})
+func (m *MongoTable[T]) Ping(ctx context.Context) error {
+	return m.col.Database().Client().Ping(ctx, readpref.Primary())
+}
+
+func (m *MongoTable[CountLog]) RemoveOldLogs(ctx context.Context, date int) (int, error) {
+	res, err := m.col.DeleteMany(ctx, bson.M{"date": bson.M{"$lt": date}})
 	if err == mongo.ErrNoDocuments {
-		return nil
+		return 0, nil
+	} else if err != nil {
+		return 0, err
 	}
-	return err
+	return int(res.DeletedCount), nil
+}
+
+func (m *MongoTable[CountLog]) CountOldLogs(ctx context.Context, date int) (int, error) {
+	out, err := m.col.CountDocuments(ctx, bson.M{"date": bson.M{"$lt": date}})
+	return int(out), err
 }
 func (m *MongoTable[CountLog]) Count(ctx context.Context, platform string) (int, error) {
 	var filter bson.M
@@ -88,3 +100,57 @@ func (m *MongoTable[CountLog]) Count(ctx context.Context, platform string) (int,
 	out, err := m.col.CountDocuments(ctx, filter)
 	return int(out), err
 }
+
+func (m *MongoTable[CountLog]) CountBy(ctx context.Context, since int, platform, field string) (map[string]int, error) {
+	match := bson.M{"date": bson.M{"$gte": since}}
+	if platform != "" && platform != "all" {
+		match["platform"] = platform
+	}
+	var groupID any
+	if field != "" {
+		groupID = "$" + field
+	}
+	res, err := m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": groupID, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Value string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	err = res.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(groups))
+	for _, g := range groups {
+		out[g.Value] += g.Count
+	}
+	return out, nil
+}
+
+func (m *MongoTable[CountSnapshot]) SnapshotsBetween(ctx context.Context, from, to int) ([]CountSnapshot, error) {
+	return m.Find(ctx, bson.M{"date": bson.M{"$gte": from, "$lte": to}})
+}
+
+func (m *MongoTable[CountLog]) CountByFirstSeen(ctx context.Context, since int, platform string) ([]backend.FirstSeenCount, error) {
+	// Legacy logs don't have firstSeen.
+	match := bson.M{"firstSeen": bson.M{"$exists": true, "$gte": since}}
+	if platform != "" && platform != "all" {
+		match["platform"] = platform
+	}
+	res, err := m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"firstSeen": "$firstSeen", "date": "$date"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "firstSeen": "$_id.firstSeen", "date": "$_id.date", "count": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []backend.FirstSeenCount
+	err = res.All(ctx, &out)
+	return out, err
+}
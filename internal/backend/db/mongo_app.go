@@ -0,0 +1,22 @@
+package db
+
+import (
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Creates MongoDB tables for Apps created from a backend.AppConfig. Each App uses the database and collections given in it's AppConfig.
+func MongoAppTables(client *mongo.Client) backend.AppTablesFunc {
+	return func(conf backend.AppConfig) (backend.AppTables, error) {
+		db := client.Database(conf.Database)
+		var out backend.AppTables
+		if conf.Count {
+			out.Count = NewMongoTable[backend.CountLog](db.Collection(conf.Collections.Count))
+			out.CountHistory = NewMongoTable[backend.CountSnapshot](db.Collection(conf.Collections.CountHistory))
+		}
+		if conf.Crash {
+			out.Crash = NewMongoCrashTable(db.Collection(conf.Collections.Crash), db.Collection(conf.Collections.CrashArchive))
+		}
+		return out, nil
+	}
+}
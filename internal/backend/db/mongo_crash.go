@@ -39,16 +39,28 @@ func (m *MongoCrashTable) IsArchived(ctx context.Context, ind backend.Individual
 
 func (m *MongoCrashTable) InsertCrash(ctx context.Context, ind backend.IndividualCrash) error {
 	first, _, _ := strings.Cut(ind.Stack, "\n")
+	if ind.Occurrences == nil {
+		ind.Occurrences = []backend.CrashOccurrence{}
+	}
 	res, err := m.col.UpdateOne(ctx,
 		bson.M{"error": ind.Error, "firstLine": first, //filter main report
 			"individual": bson.M{"$elemMatch": bson.M{"stack": ind.Stack, "platform": ind.Platform}}}, //filter individual
-		bson.M{"$inc": bson.M{"individual.$.count": 1}}, //increment count
+		bson.M{
+			"$inc": bson.M{"individual.$.count": 1}, //increment count
+			"$push": bson.M{"individual.$.occurrences": bson.M{ //add occurrence, keeping only the latest
+				"$each":  ind.Occurrences,
+				"$slice": -backend.MaxCrashOccurrences,
+			}},
+		},
 	)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return err
 	}
 	if err == mongo.ErrNoDocuments || res.MatchedCount == 0 {
 		ind.Count = 1
+		if len(ind.Occurrences) > backend.MaxCrashOccurrences {
+			ind.Occurrences = ind.Occurrences[len(ind.Occurrences)-backend.MaxCrashOccurrences:]
+		}
 		res, err = m.col.UpdateMany(ctx,
 			bson.M{"error": ind.Error, "firstLine": first}, //filter
 			bson.M{"$push": bson.M{"individual": ind}},     //Add new individual report
@@ -0,0 +1,311 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Number of characters of an API Key shown when listing deprecated route usage.
+const shownKeyLength = 6
+
+// Usage of a deprecated route by a single API Key.
+type DeprecatedUsage struct {
+	ID       string `json:"-" bson:"_id"`
+	Route    string `json:"-" bson:"route"`
+	AppID    string `json:"appID" bson:"appID"`
+	Key      string `json:"key" bson:"key"` // Only the start of the key is given. Empty if the request didn't have a valid key.
+	Count    int    `json:"count" bson:"count"`
+	LastSeen int64  `json:"lastSeen" bson:"lastSeen"` // unix timestamp (seconds)
+}
+
+func (d DeprecatedUsage) GetID() string {
+	return d.ID
+}
+
+type DeprecatedRoute struct {
+	Route     string            `json:"route"`
+	Successor string            `json:"successor,omitempty"`
+	Sunset    string            `json:"sunset,omitempty"` // YYYY-MM-DD
+	Removed   bool              `json:"removed"`
+	Total     int               `json:"total"`
+	Usage     []DeprecatedUsage `json:"usage"`
+}
+
+type deprecatedHitKey struct{}
+
+// Filled in by VerifyHeader so deprecated route usage can be attributed to an API Key.
+type deprecatedHit struct {
+	key *APIKey
+}
+
+func recordDeprecatedKey(ctx context.Context, key *APIKey) {
+	if hit, ok := ctx.Value(deprecatedHitKey{}).(*deprecatedHit); ok {
+		hit.key = key
+	}
+}
+
+// Set the date deprecated routes are removed. After this date, deprecated routes return 410 Gone.
+// Routes with their own RouteDoc.Sunset use that date instead. A zero time means deprecated routes are never removed.
+func (r *Router) SetSunset(date time.Time) {
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	r.sunset = date
+}
+
+func (r *Router) sunsetFor(doc RouteDoc) time.Time {
+	if !doc.Sunset.IsZero() {
+		return doc.Sunset
+	}
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	return r.sunset
+}
+
+// Wraps a deprecated route's handler to add the Deprecation, Sunset, and Link headers, count it's usage, and remove it after it's sunset.
+func (r *Router) deprecated(route string, h http.HandlerFunc, doc RouteDoc) http.HandlerFunc {
+	r.registerDeprecated(route, doc)
+	return func(w http.ResponseWriter, req *http.Request) {
+		hit := &deprecatedHit{}
+		if !r.deprecatedHeaders(w, req, route, doc) {
+			r.recordDeprecated(route, nil)
+			WriteError(w, req, http.StatusGone, CodeGone, "This request is no longer supported")
+			return
+		}
+		h(w, req.WithContext(context.WithValue(req.Context(), deprecatedHitKey{}, hit)))
+		r.recordDeprecated(route, hit.key)
+	}
+}
+
+// Record usage of deprecated behavior of a route that isn't deprecated itself, such as legacy request formats.
+// Returns false if the behavior has passed it's sunset, in which case the request should fail.
+func (r *Router) UseDeprecated(w http.ResponseWriter, req *http.Request, name string, key *APIKey) bool {
+	doc := RouteDoc{Deprecated: true}
+	r.registerDeprecated(name, doc)
+	ok := r.deprecatedHeaders(w, req, name, doc)
+	r.recordDeprecated(name, key)
+	return ok
+}
+
+func (r *Router) registerDeprecated(route string, doc RouteDoc) {
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	r.initUsage()
+	if _, ok := r.deprecatedDocs[route]; !ok {
+		r.deprecatedDocs[route] = doc
+	}
+	if _, ok := r.usage[route]; !ok {
+		r.usage[route] = make(map[string]*DeprecatedUsage)
+	}
+}
+
+// Must be called with usageMut locked.
+func (r *Router) initUsage() {
+	if r.deprecatedDocs == nil {
+		r.deprecatedDocs = make(map[string]RouteDoc)
+		r.usage = make(map[string]map[string]*DeprecatedUsage)
+		r.unsaved = make(map[string]*DeprecatedUsage)
+	}
+}
+
+// Sets the deprecation headers. Returns false if the route has passed it's sunset.
+func (r *Router) deprecatedHeaders(w http.ResponseWriter, req *http.Request, route string, doc RouteDoc) bool {
+	sunset := r.sunsetFor(doc)
+	w.Header().Set("Deprecation", "true")
+	if !sunset.IsZero() {
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	if doc.Successor != "" {
+		succ := pathParamRegex.ReplaceAllStringFunc(doc.Successor, func(param string) string {
+			return req.PathValue(pathParamRegex.FindStringSubmatch(param)[1])
+		})
+		w.Header().Add("Link", "<"+succ+`>; rel="successor-version"`)
+	}
+	if !sunset.IsZero() && time.Now().After(sunset) {
+		return false
+	}
+	slog.DebugContext(req.Context(), "deprecated route used", "route", route)
+	return true
+}
+
+func (r *Router) recordDeprecated(route string, key *APIKey) {
+	var id, appID string
+	if key != nil {
+		id = key.ID
+		appID = key.AppID
+	}
+	shown := id
+	if len(shown) > shownKeyLength {
+		shown = shown[:shownKeyLength] + "..."
+	}
+	// Usage is kept by the shown key so it can be saved without the full API Key.
+	usageKey := appID + " " + shown
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	use, ok := r.usage[route][usageKey]
+	if !ok {
+		use = &DeprecatedUsage{ID: route + " " + usageKey, Route: route, AppID: appID, Key: shown}
+		r.usage[route][usageKey] = use
+	}
+	use.Count++
+	use.LastSeen = time.Now().Unix()
+	deprecatedRequests.Inc(route, appID)
+	r.queueUsageSave(use)
+}
+
+// Queues the usage to be saved to the usage table. Must be called with usageMut locked.
+func (r *Router) queueUsageSave(use *DeprecatedUsage) {
+	if r.usageTable == nil {
+		return
+	}
+	r.unsaved[use.ID] = use
+	if !r.saving {
+		r.saving = true
+		go r.saveUsage()
+	}
+}
+
+// Saves queued usage until there's none left. Only one saveUsage runs at a time so older counts can't overwrite newer ones.
+func (r *Router) saveUsage() {
+	for {
+		r.usageMut.Lock()
+		if len(r.unsaved) == 0 {
+			r.saving = false
+			r.usageMut.Unlock()
+			return
+		}
+		toSave := make([]DeprecatedUsage, 0, len(r.unsaved))
+		for _, use := range r.unsaved {
+			toSave = append(toSave, *use)
+		}
+		clear(r.unsaved)
+		tab := r.usageTable
+		r.usageMut.Unlock()
+		for _, use := range toSave {
+			err := tab.FullUpdate(context.Background(), use.ID, use)
+			if err == ErrNotFound {
+				err = tab.Insert(context.Background(), use)
+			}
+			if err != nil {
+				slog.Error("error saving deprecated route usage", "route", use.Route, "err", err)
+			}
+		}
+	}
+}
+
+// Save usage of deprecated routes to tab so it's kept when the server restarts. Usage already saved in tab is loaded and added to the current usage.
+func (r *Router) PersistUsage(ctx context.Context, tab Table[DeprecatedUsage]) error {
+	saved, err := tab.Find(ctx, map[string]any{})
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	r.initUsage()
+	r.usageTable = tab
+	// Usage from before the table was set. Saved usage is added before these are saved.
+	for _, routeUsage := range r.usage {
+		for _, use := range routeUsage {
+			r.queueUsageSave(use)
+		}
+	}
+	for _, s := range saved {
+		if r.usage[s.Route] == nil {
+			r.usage[s.Route] = make(map[string]*DeprecatedUsage)
+		}
+		usageKey := s.AppID + " " + s.Key
+		use, ok := r.usage[s.Route][usageKey]
+		if !ok {
+			r.usage[s.Route][usageKey] = &s
+			continue
+		}
+		use.Count += s.Count
+		use.LastSeen = max(use.LastSeen, s.LastSeen)
+	}
+	return nil
+}
+
+// Get the usage of all deprecated routes. If appID is not empty, only usage by that App is returned.
+// Usage is counted since the server started unless it's persisted with PersistUsage.
+func (r *Router) DeprecatedRoutes(appID string) []DeprecatedRoute {
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	out := make([]DeprecatedRoute, 0, len(r.usage))
+	// Saved usage can be for behavior that hasn't been used since the server started, so it's documentation isn't known yet.
+	for route := range r.usage {
+		doc, ok := r.deprecatedDocs[route]
+		if !ok {
+			doc = RouteDoc{Deprecated: true}
+		}
+		dep := DeprecatedRoute{
+			Route:     route,
+			Successor: doc.Successor,
+			Usage:     make([]DeprecatedUsage, 0, len(r.usage[route])),
+		}
+		sunset := doc.Sunset
+		if sunset.IsZero() {
+			sunset = r.sunset
+		}
+		if !sunset.IsZero() {
+			dep.Sunset = sunset.Format(time.DateOnly)
+			dep.Removed = time.Now().After(sunset)
+		}
+		for _, use := range r.usage[route] {
+			if appID != "" && use.AppID != appID {
+				continue
+			}
+			dep.Total += use.Count
+			dep.Usage = append(dep.Usage, *use)
+		}
+		slices.SortFunc(dep.Usage, func(a, b DeprecatedUsage) int {
+			return b.Count - a.Count
+		})
+		out = append(out, dep)
+	}
+	slices.SortFunc(out, func(a, b DeprecatedRoute) int {
+		return strings.Compare(a.Route, b.Route)
+	})
+	return out
+}
+
+var getDeprecationsDoc = RouteDoc{
+	Summary:     "Get usage of deprecated routes",
+	Description: "Usage is counted since the server started unless it's persisted, as given by persisted. Unless using the management key, only usage by the key's App is returned.",
+	Tags:        []string{"management"},
+	Permission:  "management",
+	Response:    ObjectSchema(map[string]any{"persisted": false, "routes": []DeprecatedRoute{}}),
+}
+
+func (b *Backend) getDeprecations(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	appID := hdr.Key.AppID
+	if b.isManagementKey(hdr.Key) {
+		appID = ""
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{"persisted": b.m.usagePersisted(), "routes": b.m.DeprecatedRoutes(appID)})
+}
+
+func (r *Router) usagePersisted() bool {
+	r.usageMut.Lock()
+	defer r.usageMut.Unlock()
+	return r.usageTable != nil
+}
+
+// Save usage of deprecated routes so it's kept when the server restarts. See Router.PersistUsage.
+func (b *Backend) PersistDeprecatedUsage(ctx context.Context, tab Table[DeprecatedUsage]) error {
+	return b.m.PersistUsage(ctx, tab)
+}
+
+// Set the date deprecated routes are removed. See Router.SetSunset.
+func (b *Backend) SetLegacySunset(date time.Time) {
+	b.m.SetSunset(date)
+}
@@ -2,8 +2,7 @@ package backend
 
 import (
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -50,7 +49,7 @@ func (b *Backend) ParseHeader(r *http.Request) (*ParsedHeader, error) {
 		}
 		out.Key = &apiKey
 	} else {
-		fmt.Println("origin:", r.Header.Get("origin"))
+		slog.DebugContext(r.Context(), "finding API key by origin", "origin", r.Header.Get("origin"))
 		keys, err := b.keyTable.Find(r.Context(), map[string]any{"allowedOrigins": r.Header.Get("origin")})
 		if err == ErrNotFound {
 			return nil, ErrAPIKeyUnauthorized
@@ -79,7 +78,8 @@ func (b *Backend) ParseHeader(r *http.Request) (*ParsedHeader, error) {
 
 // Similiar to ParseHeader, but with key checking and automatic error returns. Guarentess Backend.GetApp is non-nil
 // Checks that the key is a management key (not management permission and if allowManagement is true) or that it has the necessary permission.
-// If the check if failed, ReturnError will be called and the returned *ParsedHeader will be nil.
+// If keyPerm is empty, any key for an App is allowed.
+// If the check if failed, an error is written and the returned *ParsedHeader will be nil.
 // If token is present but invalid, no error will be returned just ParsedHeader.User will be nil.
 // The error return will only be populated on "internal" errors and should *probably* be logged.
 //
@@ -88,28 +88,39 @@ func (b *Backend) VerifyHeader(w http.ResponseWriter, r *http.Request, keyPerm s
 	hdr, err := b.ParseHeader(r)
 	if hdr == nil || hdr.Key == nil {
 		if err == ErrAPIKeyUnauthorized {
-			ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application not authorized")
+			verifyFailures.Inc("invalidKey")
+			WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
 			return nil, nil
 		}
-		ReturnError(w, http.StatusUnauthorized, "noKey", "No API Key provided")
+		verifyFailures.Inc("noKey")
+		WriteError(w, r, http.StatusUnauthorized, CodeNoKey, "No API Key provided")
 		return nil, err
 	}
+	recordDeprecatedKey(r.Context(), hdr.Key)
 	if err != nil && !errors.Is(err, ErrTokenUnauthorized) {
-		log.Println("error parsing header:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error parsing header", "err", err)
+		verifyFailures.Inc("internal")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return nil, err
 	}
-	if hdr.Key.AppID == b.managementKeyID {
+	if b.isManagementKey(hdr.Key) {
 		if allowManagementKey {
 			return hdr, nil
 		} else {
-			ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application not authorized")
+			verifyFailures.Inc("invalidKey")
+			WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
 			return nil, nil
 		}
 	}
-	if _, ok := b.apps[hdr.Key.AppID]; !ok {
-		ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application not authorized")
+	if b.app(hdr.Key.AppID) == nil {
+		verifyFailures.Inc("invalidKey")
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
 		return nil, errors.New("server misconfigured, appID present in DB, but App not added to backend")
 	}
+	if keyPerm != "" && !hdr.Key.Perm[keyPerm] {
+		verifyFailures.Inc("invalidKey")
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "API Key does not have the "+keyPerm+" permission")
+		return nil, nil
+	}
 	return hdr, nil
 }
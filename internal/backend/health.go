@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long readiness results are reused before the stores are pinged again.
+	readyCacheDuration = 5 * time.Second
+	// How long a single store has to respond to a ping.
+	pingTimeout = 2 * time.Second
+)
+
+// Allows for a store, such as a Table, to be checked for readiness by /readyz.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// Allows a function to be used as a Pinger.
+type PingerFunc func(context.Context) error
+
+func (p PingerFunc) Ping(ctx context.Context) error {
+	return p(ctx)
+}
+
+type ComponentStatus struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"durationMs"`
+}
+
+type readiness struct {
+	Status     string            `json:"status"`
+	Checked    int64             `json:"checked"`
+	Components []ComponentStatus `json:"components"`
+}
+
+type healthChecks struct {
+	mut     sync.Mutex
+	extra   map[string]Pinger
+	last    readiness
+	lastOK  bool
+	checked time.Time
+}
+
+var (
+	healthzDoc = RouteDoc{
+		Summary:  "Check that the server is running",
+		Tags:     []string{"health"},
+		Response: ObjectSchema(map[string]any{"status": ""}),
+	}
+	readyzDoc = RouteDoc{
+		Summary:     "Check that the server's stores are available",
+		Description: "Returns 503 if any component is unavailable. Results are cached for a few seconds.",
+		Tags:        []string{"health"},
+		Response:    readiness{},
+	}
+)
+
+// Add an additional check to /readyz, such as the database client used by the Backend's tables.
+func (b *Backend) AddHealthCheck(name string, p Pinger) {
+	b.health.mut.Lock()
+	defer b.health.mut.Unlock()
+	if b.health.extra == nil {
+		b.health.extra = make(map[string]Pinger)
+	}
+	b.health.extra[name] = p
+	b.health.checked = time.Time{}
+}
+
+// All components that can be pinged, keyed by name. Tables that don't implement Pinger are skipped.
+func (b *Backend) pingers() map[string]Pinger {
+	out := make(map[string]Pinger)
+	for name, p := range b.health.extra {
+		out[name] = p
+	}
+	if p, ok := b.keyTable.(Pinger); ok {
+		out["keyTable"] = p
+	}
+	if p, ok := b.userTable.(Pinger); ok {
+		out["userTable"] = p
+	}
+	if p, ok := b.configTable.(Pinger); ok {
+		out["configTable"] = p
+	}
+	if p, ok := b.announcementTable.(Pinger); ok {
+		out["announcementTable"] = p
+	}
+	for _, a := range b.appList() {
+		if p, ok := a.CountTable().(Pinger); ok {
+			out[a.AppID()+"/countTable"] = p
+		}
+		if p, ok := a.CrashTable().(Pinger); ok {
+			out[a.AppID()+"/crashTable"] = p
+		}
+	}
+	return out
+}
+
+// Ping every component at the same time. Results are cached for readyCacheDuration.
+func (b *Backend) checkReadiness(ctx context.Context) (readiness, bool) {
+	b.health.mut.Lock()
+	defer b.health.mut.Unlock()
+	if time.Since(b.health.checked) < readyCacheDuration {
+		return b.health.last, b.health.lastOK
+	}
+	pingers := b.pingers()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pingTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	var resMut sync.Mutex
+	comps := make([]ComponentStatus, 0, len(pingers))
+	for name, p := range pingers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := p.Ping(ctx)
+			stat := ComponentStatus{
+				Name:     name,
+				Status:   "ok",
+				Duration: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				stat.Status = "unavailable"
+				stat.Error = err.Error()
+			}
+			resMut.Lock()
+			comps = append(comps, stat)
+			resMut.Unlock()
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(comps, func(a, b ComponentStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	ok := true
+	for _, c := range comps {
+		if c.Status != "ok" {
+			ok = false
+			break
+		}
+	}
+	b.health.checked = time.Now()
+	b.health.last = readiness{
+		Status:     "ok",
+		Checked:    b.health.checked.Unix(),
+		Components: comps,
+	}
+	if !ok {
+		b.health.last.Status = "unavailable"
+	}
+	b.health.lastOK = ok
+	return b.health.last, ok
+}
+
+// Reports that the process is up. Does not check any stores.
+func (b *Backend) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Reports the status of every store the Backend uses. Returns 503 if any are unavailable.
+func (b *Backend) readyz(w http.ResponseWriter, r *http.Request) {
+	res, ok := b.checkReadiness(r.Context())
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, res)
+}
@@ -0,0 +1,251 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of days counted as part of ActiveUsers.Weekly and ActiveUsers.Monthly.
+const (
+	weeklyDays  = 7
+	monthlyDays = 30
+)
+
+type ActiveUsers struct {
+	Daily   int `json:"daily" bson:"daily"`
+	Weekly  int `json:"weekly" bson:"weekly"`
+	Monthly int `json:"monthly" bson:"monthly"`
+}
+
+// Active users for a specific value of a CountLog field, such as a platform or version.
+type ActiveBreakdown struct {
+	Value       string `json:"value" bson:"value"`
+	ActiveUsers `bson:",inline"`
+}
+
+// A daily snapshot of active users. Since CountLogs only store the last time an install was seen,
+// a day's snapshot is updated throughout the day and is only final after the last update of the day.
+type CountSnapshot struct {
+	ID        string            `json:"-" bson:"_id"`
+	Date      int               `json:"date" bson:"date"`
+	Updated   int64             `json:"updated" bson:"updated"`
+	Total     ActiveUsers       `json:"total" bson:"total"`
+	Platforms []ActiveBreakdown `json:"platforms" bson:"platforms"`
+	Versions  []ActiveBreakdown `json:"versions" bson:"versions"`
+	// If the App's log retention is shorter then the weekly or monthly window. Windows are shortened to the retention period, so their values are lower then they would otherwise be.
+	Partial bool `json:"partial,omitempty" bson:"partial,omitempty"`
+}
+
+func (c CountSnapshot) GetID() string {
+	return c.ID
+}
+
+// Allows for an App to keep a history of it's active users. Snapshots are created from the App's CountTable and are not removed during cleanup.
+type CountHistoryApp interface {
+	App
+	CountHistoryTable() CountHistoryTable
+}
+
+// A single point returned by GET /count/history. For weeks and months, the last snapshot of the period is used as it has the most complete weekly and monthly values.
+type historyPoint struct {
+	Period string `json:"period"`
+	CountSnapshot
+}
+
+var getCountHistoryDoc = RouteDoc{
+	Summary:    "Get the history of active users",
+	Tags:       []string{"count"},
+	Permission: "management",
+	Query: []Param{
+		{Name: "from", Description: "First day to include, formatted as YYYY-MM-DD. Defaults to 30 days before to."},
+		{Name: "to", Description: "Last day to include, formatted as YYYY-MM-DD. Defaults to today."},
+		{Name: "granularity", Description: "Can be day, week, or month. Defaults to day."},
+	},
+	Response: ObjectSchema(map[string]any{"granularity": "", "history": []historyPoint{}}),
+}
+
+func (b *Backend) historyLoop() {
+	b.snapshotCounts()
+	for range time.Tick(time.Hour) {
+		b.snapshotCounts()
+	}
+}
+
+func (b *Backend) snapshotCounts() {
+	now := time.Now()
+	for _, a := range b.appList() {
+		histApp, ok := a.(CountHistoryApp)
+		if !ok || histApp.CountHistoryTable() == nil || a.CountTable() == nil {
+			continue
+		}
+		snap, err := createSnapshot(context.Background(), a.CountTable(), now, logRetention(a))
+		if err != nil {
+			slog.Error("error creating count snapshot", "app", a.AppID(), "err", err)
+			continue
+		}
+		tab := histApp.CountHistoryTable()
+		err = tab.FullUpdate(context.Background(), snap.ID, snap)
+		if err == ErrNotFound {
+			err = tab.Insert(context.Background(), snap)
+		}
+		if err != nil {
+			slog.Error("error saving count snapshot", "app", a.AppID(), "err", err)
+		}
+	}
+}
+
+// Logs older then retention are not counted, even if they haven't been removed yet, so snapshots don't change depending on when the last cleanup was.
+func createSnapshot(ctx context.Context, tab CountTable, now time.Time, retention time.Duration) (CountSnapshot, error) {
+	date := getDate(now)
+	snap := CountSnapshot{
+		ID:      strconv.Itoa(date),
+		Date:    date,
+		Updated: now.Unix(),
+	}
+	since := []int{
+		date,
+		getDate(now.AddDate(0, 0, -(weeklyDays - 1))),
+		getDate(now.AddDate(0, 0, -(monthlyDays - 1))),
+	}
+	cutoff := getDate(now.Add(-retention))
+	for i := range since {
+		if since[i] < cutoff {
+			since[i] = cutoff
+			snap.Partial = true
+		}
+	}
+	var totals [3]map[string]int
+	var platforms, versions [3]map[string]int
+	var err error
+	for i := range since {
+		totals[i], err = tab.CountBy(ctx, since[i], "all", "")
+		if err != nil {
+			return snap, err
+		}
+		platforms[i], err = tab.CountBy(ctx, since[i], "all", "platform")
+		if err != nil {
+			return snap, err
+		}
+		versions[i], err = tab.CountBy(ctx, since[i], "all", "version")
+		if err != nil {
+			return snap, err
+		}
+	}
+	snap.Total = ActiveUsers{
+		Daily:   totals[0][""],
+		Weekly:  totals[1][""],
+		Monthly: totals[2][""],
+	}
+	snap.Platforms = toBreakdown(platforms)
+	snap.Versions = toBreakdown(versions)
+	return snap, nil
+}
+
+// Combines daily, weekly, and monthly counts into a list of ActiveBreakdown sorted by value.
+func toBreakdown(counts [3]map[string]int) []ActiveBreakdown {
+	// The monthly window contains every value of the smaller windows.
+	out := make([]ActiveBreakdown, 0, len(counts[2]))
+	for val := range counts[2] {
+		out = append(out, ActiveBreakdown{
+			Value: val,
+			ActiveUsers: ActiveUsers{
+				Daily:   counts[0][val],
+				Weekly:  counts[1][val],
+				Monthly: counts[2][val],
+			},
+		})
+	}
+	slices.SortFunc(out, func(a, b ActiveBreakdown) int {
+		return strings.Compare(a.Value, b.Value)
+	})
+	return out
+}
+
+func (b *Backend) getCountHistory(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	var ap App
+	if b.isManagementKey(hdr.Key) {
+		ap = b.app(r.PathValue("appID"))
+		if ap == nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+			return
+		}
+	} else {
+		ap = b.GetApp(hdr.Key)
+	}
+	histApp, ok := ap.(CountHistoryApp)
+	if !ok || histApp.CountHistoryTable() == nil {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Trying to get count history on app that doesn't have a history table")
+		return
+	}
+	to := time.Now()
+	if q := r.URL.Query().Get("to"); q != "" {
+		to, err = time.Parse(time.DateOnly, q)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "to must be formatted as YYYY-MM-DD")
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -monthlyDays)
+	if q := r.URL.Query().Get("from"); q != "" {
+		from, err = time.Parse(time.DateOnly, q)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "from must be formatted as YYYY-MM-DD")
+			return
+		}
+	}
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	var bucket func(time.Time) string
+	switch granularity {
+	case "day":
+		bucket = func(t time.Time) string { return t.Format(time.DateOnly) }
+	case "week":
+		bucket = func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return strconv.Itoa(year) + "-W" + strconv.Itoa(week)
+		}
+	case "month":
+		bucket = func(t time.Time) string { return t.Format("2006-01") }
+	default:
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "granularity must be day, week, or month")
+		return
+	}
+	snaps, err := histApp.CountHistoryTable().SnapshotsBetween(r.Context(), getDate(from), getDate(to))
+	if err != nil && err != ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting count history", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	slices.SortFunc(snaps, func(a, b CountSnapshot) int {
+		return a.Date - b.Date
+	})
+	out := make([]historyPoint, 0, len(snaps))
+	for _, s := range snaps {
+		period := bucket(dateToTime(s.Date))
+		if len(out) > 0 && out[len(out)-1].Period == period {
+			out[len(out)-1].CountSnapshot = s
+		} else {
+			out = append(out, historyPoint{Period: period, CountSnapshot: s})
+		}
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{"granularity": granularity, "history": out})
+}
+
+// Converts a date created by getDate back to a time.Time.
+func dateToTime(date int) time.Time {
+	return time.Date(date/10000, time.Month((date/100)%100), date%100, 0, 0, 0, 0, time.Local)
+}
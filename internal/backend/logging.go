@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLogFormat = errors.New("log format must be text or json")
+)
+
+type requestIDKey struct{}
+
+// Maximum length of a X-Request-ID header value that will be used as the request ID.
+const maxRequestIDLength = 128
+
+// Get the request ID set by RequestLogger. Returns an empty string if not set.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Add a request ID to the context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+// Wraps a slog.Handler so records logged with a context that has a request ID include it as the requestID attribute.
+func NewContextHandler(h slog.Handler) slog.Handler {
+	return contextHandler{Handler: h}
+}
+
+func (c contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		rec.AddAttrs(slog.String("requestID", id))
+	}
+	return c.Handler.Handle(ctx, rec)
+}
+
+func (c contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: c.Handler.WithAttrs(attrs)}
+}
+
+func (c contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: c.Handler.WithGroup(name)}
+}
+
+// Create a new slog.Logger with the given level (debug, info, warn, or error) and format (text or json).
+// The logger includes request IDs (see NewContextHandler).
+func NewLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case "text", "":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return nil, ErrLogFormat
+	}
+	return slog.New(NewContextHandler(h)), nil
+}
+
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (a *accessRecorder) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *accessRecorder) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(b)
+	a.size += n
+	return n, err
+}
+
+func (a *accessRecorder) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// Adds a request ID to every request and logs each request once it's finished.
+// The request ID is taken from the X-Request-ID header if present, otherwise one is generated. The ID is returned in the X-Request-ID header.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, func(c rune) bool { return c < ' ' || c > '~' }) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+		rec := &accessRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"host", r.Host,
+			"path", r.URL.Path,
+			"pattern", r.Pattern,
+			"status", rec.status,
+			"size", rec.size,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
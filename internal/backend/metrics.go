@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/CalebQ42/darkstorm-server/internal/metrics"
+)
+
+var (
+	verifyFailures = metrics.NewCounter("darkstorm_verify_header_failures_total",
+		"Number of requests rejected by VerifyHeader by error code.", "code")
+	crashInserts = metrics.NewCounter("darkstorm_crash_inserts_total",
+		"Number of crashes added to crash tables by app.", "app")
+	countPings = metrics.NewCounter("darkstorm_count_pings_total",
+		"Number of successful count requests by app and platform. Unknown platforms are counted as other.", "app", "platform")
+	deprecatedRequests = metrics.NewCounter("darkstorm_deprecated_requests_total",
+		"Number of requests to deprecated routes by route and app.", "route", "app")
+)
+
+// Platforms that get their own platform label. Platforms are client provided, so anything else is counted as "other" to keep the number of labels bounded.
+var metricPlatforms = map[string]bool{
+	"android": true,
+	"ios":     true,
+	"web":     true,
+	"windows": true,
+	"macos":   true,
+	"linux":   true,
+	"fuchsia": true,
+}
+
+// Returns the platform label used for the given client provided platform.
+func metricPlatform(platform string) string {
+	platform = strings.ToLower(platform)
+	if metricPlatforms[platform] {
+		return platform
+	}
+	return "other"
+}
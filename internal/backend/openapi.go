@@ -0,0 +1,406 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openAPIVersion = "3.0.3"
+
+var pathParamRegex = regexp.MustCompile(`{([^}.]+)(\.\.\.)?}`)
+
+// An OpenAPI schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	MinLength            int                `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             int                `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+
+	// Go type the Schema is created from when the specification is generated.
+	goType reflect.Type
+}
+
+// Create an object Schema with the given properties. Values can either be a *Schema or a value who's type is used to create one.
+func ObjectSchema(props map[string]any) *Schema {
+	out := &Schema{Type: "object", Properties: make(map[string]*Schema, len(props))}
+	for k, v := range props {
+		out.Properties[k] = toSchema(v)
+	}
+	return out
+}
+
+// Create an array Schema. items can either be a *Schema or a value who's type is used to create one.
+func ArraySchema(items any) *Schema {
+	return &Schema{Type: "array", Items: toSchema(items)}
+}
+
+func toSchema(v any) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return &Schema{goType: reflect.TypeOf(v)}
+}
+
+// Creates schemas from Go types, keeping named structs as components.
+type schemaBuilder struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Resolve v to a Schema. v can either be a *Schema or a value who's type is used to create one.
+func (s *schemaBuilder) resolve(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+	return s.resolveSchema(toSchema(v))
+}
+
+// Create Schemas for any Go types in the schema.
+func (s *schemaBuilder) resolveSchema(sch *Schema) *Schema {
+	if sch == nil {
+		return nil
+	}
+	if sch.goType != nil {
+		return s.schemaOf(sch.goType)
+	}
+	out := *sch
+	if sch.Properties != nil {
+		out.Properties = make(map[string]*Schema, len(sch.Properties))
+		for k, v := range sch.Properties {
+			out.Properties[k] = s.resolveSchema(v)
+		}
+	}
+	out.Items = s.resolveSchema(sch.Items)
+	out.AdditionalProperties = s.resolveSchema(sch.AdditionalProperties)
+	return &out
+}
+
+func (s *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if t == reflect.TypeFor[json.RawMessage]() {
+		// Any JSON value
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.componentName(t)
+			s.names[t] = name
+			// Placeholder to allow recursive types.
+			s.components[name] = &Schema{}
+			*s.components[name] = *s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (s *schemaBuilder) componentName(t reflect.Type) string {
+	name := strings.NewReplacer("[", "_", "]", "", "/", "_", ".", "_", "*", "", ",", "_").Replace(t.Name())
+	// Unexported types are still given an exported looking name.
+	name = strings.ToUpper(name[:1]) + name[1:]
+	if _, taken := s.components[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name = pkg + "_" + name
+	base := name
+	for i := 2; ; i++ {
+		if _, taken := s.components[name]; !taken {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+func (s *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	out := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := s.structSchema(ft)
+				for k, v := range embedded.Properties {
+					if _, has := out.Properties[k]; !has {
+						out.Properties[k] = v
+						if slices.Contains(embedded.Required, k) {
+							out.Required = append(out.Required, k)
+						}
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := s.schemaOf(f.Type)
+		if tag := f.Tag.Get("validate"); tag != "" {
+			if slices.ContainsFunc(parseRules(tag), func(r rule) bool { return r.name == "required" }) {
+				out.Required = append(out.Required, name)
+			}
+			prop = validationSchema(prop, f.Type, tag)
+		}
+		out.Properties[name] = prop
+	}
+	return out
+}
+
+// Adds the constraints from a validate struct tag to the field's schema. See Validate.
+func validationSchema(sch *Schema, t reflect.Type, tag string) *Schema {
+	if sch.Ref != "" {
+		return sch
+	}
+	out := *sch
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, r := range parseRules(tag) {
+		n, _ := strconv.Atoi(r.arg)
+		switch {
+		case r.name == "min" && isNumber(t.Kind()):
+			out.Minimum = &n
+		case r.name == "max" && isNumber(t.Kind()):
+			out.Maximum = &n
+		case r.name == "min" && t.Kind() == reflect.String:
+			out.MinLength = n
+		case r.name == "max" && t.Kind() == reflect.String:
+			out.MaxLength = &n
+		case r.name == "min":
+			out.MinItems = n
+		case r.name == "max":
+			out.MaxItems = &n
+		case r.name == "oneof":
+			out.Enum = strings.Fields(r.arg)
+		}
+	}
+	return &out
+}
+
+// Get the OpenAPI 3 specification for all documented routes.
+func (b *Backend) OpenAPI() map[string]any {
+	sch := newSchemaBuilder()
+	errSchema := sch.resolve(ErrorResponse{})
+	paths := make(map[string]map[string]any)
+	for _, r := range b.m.Routes() {
+		path := r.Path
+		if i := strings.Index(path, "/"); i > 0 {
+			// Remove the host
+			path = path[i:]
+		}
+		path = pathParamRegex.ReplaceAllString(path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(r.Method)] = b.openAPIOperation(sch, r, errSchema)
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Darkstorm Backend",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": sch.components,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-API-Key",
+				},
+				"userToken": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+func (b *Backend) openAPIOperation(sch *schemaBuilder, r Route, errSchema *Schema) map[string]any {
+	op := map[string]any{}
+	if r.Summary != "" {
+		op["summary"] = r.Summary
+	}
+	desc := []string{}
+	if r.Description != "" {
+		desc = append(desc, r.Description)
+	}
+	if r.Permission != "" {
+		desc = append(desc, "API Key must have the `"+r.Permission+"` permission.")
+	}
+	if r.Deprecated {
+		op["deprecated"] = true
+		if r.Successor != "" {
+			desc = append(desc, "Replaced by "+r.Successor+".")
+		}
+	}
+	if len(desc) > 0 {
+		op["description"] = strings.Join(desc, "\n\n")
+	}
+	if len(r.Tags) > 0 {
+		op["tags"] = r.Tags
+	}
+	// All schemes must be satisfied, so they're given as a single requirement.
+	security := make(map[string][]string)
+	if r.Permission != "" {
+		security["apiKey"] = []string{}
+	}
+	if r.UserAuth {
+		security["userToken"] = []string{}
+	}
+	if len(security) > 0 {
+		op["security"] = []map[string][]string{security}
+	}
+	var params []map[string]any
+	for _, m := range pathParamRegex.FindAllStringSubmatch(r.Path, -1) {
+		p := Param{Name: m[1], Required: true}
+		for _, doc := range r.PathParams {
+			if doc.Name == p.Name {
+				p.Description = doc.Description
+				p.Type = doc.Type
+			}
+		}
+		params = append(params, openAPIParam(p, "path"))
+	}
+	for _, p := range r.Query {
+		params = append(params, openAPIParam(p, "query"))
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if r.Request != nil {
+		typ := r.RequestType
+		if typ == "" {
+			typ = "application/json"
+		}
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				typ: map[string]any{"schema": sch.resolve(r.Request)},
+			},
+		}
+	}
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if r.Response != nil {
+		typ := r.ResponseType
+		if typ == "" {
+			typ = "application/json"
+		}
+		success["content"] = map[string]any{
+			typ: map[string]any{"schema": sch.resolve(r.Response)},
+		}
+	}
+	op["responses"] = map[string]any{
+		strconv.Itoa(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": errSchema},
+			},
+		},
+	}
+	return op
+}
+
+func openAPIParam(p Param, in string) map[string]any {
+	typ := p.Type
+	if typ == "" {
+		typ = "string"
+	}
+	out := map[string]any{
+		"name":   p.Name,
+		"in":     in,
+		"schema": Schema{Type: typ},
+	}
+	if p.Description != "" {
+		out["description"] = p.Description
+	}
+	if p.Required {
+		out["required"] = true
+	}
+	return out
+}
+
+var openAPIDoc = RouteDoc{
+	Summary:  "Get the OpenAPI specification",
+	Response: &Schema{Type: "object"},
+}
+
+func (b *Backend) openAPISpec(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, b.OpenAPI())
+}
@@ -0,0 +1,303 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A remote config value of an App. Clients get the resolved values with GET /{appID}/config.
+type ConfigEntry struct {
+	// {appID}:{key}
+	ID    string `json:"-" bson:"_id"`
+	AppID string `json:"appID" bson:"appID"`
+	Key   string `json:"key" bson:"key"`
+	// Only shown to management.
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	// Value used if no rules match. Can be any JSON value.
+	Value json.RawMessage `json:"value" bson:"value"`
+	// Checked in order. The first matching rule's value is used.
+	Rules []ConfigRule `json:"rules,omitempty" bson:"rules,omitempty"`
+	// unix timestamp (seconds)
+	Updated int64 `json:"updated" bson:"updated"`
+}
+
+func (c ConfigEntry) GetID() string {
+	return c.ID
+}
+
+// Targets a different value to some clients. Empty fields match every client.
+type ConfigRule struct {
+	Platforms []string `json:"platforms,omitempty" bson:"platforms,omitempty" validate:"max=32"`
+	// Minimum version, inclusive.
+	MinVersion string `json:"minVersion,omitempty" bson:"minVersion,omitempty" validate:"max=64"`
+	// Maximum version, inclusive.
+	MaxVersion string `json:"maxVersion,omitempty" bson:"maxVersion,omitempty" validate:"max=64"`
+	// Percentage of installs (0-100) that match the rule. If nil, every install matches. 0 matches no installs, such as to pause a rollout.
+	// Installs are bucketed by their count ID, so the same install always gets the same value.
+	// Clients that don't send their count ID only match rules without a rollout or with a rollout of 100.
+	Rollout *int            `json:"rollout,omitempty" bson:"rollout,omitempty"`
+	Value   json.RawMessage `json:"value" bson:"value" validate:"required"`
+}
+
+// The client a config is being resolved for.
+type configClient struct {
+	platform string
+	version  string
+	id       string
+}
+
+func (c ConfigRule) matches(entryID string, cl configClient) bool {
+	if len(c.Platforms) > 0 && !slices.Contains(c.Platforms, cl.platform) {
+		return false
+	}
+	if !inVersionRange(cl.version, c.MinVersion, c.MaxVersion) {
+		return false
+	}
+	if c.Rollout != nil && *c.Rollout < 100 {
+		if *c.Rollout <= 0 || cl.id == "" {
+			return false
+		}
+		return rolloutBucket(entryID, cl.id) < *c.Rollout
+	}
+	return true
+}
+
+// The value of the entry for the given client.
+func (c ConfigEntry) resolve(cl configClient) json.RawMessage {
+	for _, rule := range c.Rules {
+		if rule.matches(c.ID, cl) {
+			return rule.Value
+		}
+	}
+	return c.Value
+}
+
+// Bucket (0-99) of an install for a config entry. The entry's ID is included so the same installs aren't always in every rollout.
+func rolloutBucket(entryID, installID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(entryID))
+	h.Write([]byte{0})
+	h.Write([]byte(installID))
+	return int(h.Sum32() % 100)
+}
+
+type configEntryReq struct {
+	Key         string          `json:"key" validate:"required,max=128"`
+	Description string          `json:"description" validate:"max=1024"`
+	Value       json.RawMessage `json:"value" validate:"required"`
+	Rules       []ConfigRule    `json:"rules" validate:"max=50"`
+}
+
+type clientConfig struct {
+	Config map[string]json.RawMessage `json:"config"`
+}
+
+var (
+	getClientConfigDoc = RouteDoc{
+		Summary:     "Get the App's remote config",
+		Description: "Returns the value of every config key for the client. Responses include an ETag, and requests with a matching If-None-Match header return 304.",
+		Tags:        []string{"config"},
+		Query: []Param{
+			{Name: "platform", Description: "Client's platform."},
+			{Name: "version", Description: "Client's App version."},
+			{Name: "id", Description: "Client's count ID. Required to be included in percentage rollouts."},
+		},
+		Response: clientConfig{},
+	}
+	getConfigEntriesDoc = RouteDoc{
+		Summary:     "Get the App's remote config entries",
+		Description: "Returns every entry including it's targeting rules. Management keys for the App or the management key may be used.",
+		Tags:        []string{"config"},
+		Permission:  "management",
+		Response:    ObjectSchema(map[string]any{"entries": []ConfigEntry{}}),
+	}
+	setConfigEntryDoc = RouteDoc{
+		Summary:     "Add or update a remote config entry",
+		Description: "If the key already exists, it's replaced. Rules are checked in order and the first match's value is used. Management keys for the App or the management key may be used.",
+		Tags:        []string{"config"},
+		Permission:  "management",
+		Request:     configEntryReq{},
+		Response:    ConfigEntry{},
+		Status:      http.StatusCreated,
+	}
+	deleteConfigEntryDoc = RouteDoc{
+		Summary:     "Delete a remote config entry",
+		Description: "Management keys for the App or the management key may be used.",
+		Tags:        []string{"config"},
+		Permission:  "management",
+		Response:    ObjectSchema(map[string]any{"key": ""}),
+	}
+)
+
+// Enables remote config for all Apps. Entries of every App are stored in tab.
+// App routes take precedence over GET /{appID}/config, so Apps with a matching route (such as the blog's GET /blog/{blogID}) can't get their config.
+func (b *Backend) EnableRemoteConfig(tab Table[ConfigEntry]) {
+	b.configTable = tab
+	b.m.handleAppResource("GET", "config", b.getClientConfig, getClientConfigDoc)
+	b.m.HandleDoc("GET /{appID}/config/entries", b.getConfigEntries, getConfigEntriesDoc)
+	b.m.HandleDoc("POST /{appID}/config/entries", b.setConfigEntry, setConfigEntryDoc)
+	b.m.HandleDoc("DELETE /{appID}/config/entries/{key}", b.deleteConfigEntry, deleteConfigEntryDoc)
+}
+
+// Verifies the request's key can be used with the appID path value. The management key can be used with every App.
+// If not, an error is written and nil is returned.
+func (b *Backend) remoteConfigApp(w http.ResponseWriter, r *http.Request, perm string) App {
+	hdr, err := b.VerifyHeader(w, r, perm, true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return nil
+	}
+	appID := r.PathValue("appID")
+	if hdr.Key.AppID != appID && !b.isManagementKey(hdr.Key) {
+		WriteError(w, r, http.StatusUnauthorized, CodeInvalidKey, "Application not authorized")
+		return nil
+	}
+	ap := b.app(appID)
+	if ap == nil {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "App not found")
+		return nil
+	}
+	return ap
+}
+
+// Get all config entries of the App, sorted by key.
+func (b *Backend) configEntries(r *http.Request, appID string) ([]ConfigEntry, error) {
+	entries, err := b.configTable.Find(r.Context(), map[string]any{"appID": appID})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b ConfigEntry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return entries, nil
+}
+
+// If the If-None-Match header includes etag.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) getClientConfig(w http.ResponseWriter, r *http.Request) {
+	ap := b.remoteConfigApp(w, r, "")
+	if ap == nil {
+		return
+	}
+	entries, err := b.configEntries(r, ap.AppID())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting config entries", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	q := r.URL.Query()
+	cl := configClient{
+		platform: q.Get("platform"),
+		version:  q.Get("version"),
+		id:       q.Get("id"),
+	}
+	out := clientConfig{Config: make(map[string]json.RawMessage, len(entries))}
+	for _, e := range entries {
+		out.Config[e.Key] = e.resolve(cl)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error encoding config", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (b *Backend) getConfigEntries(w http.ResponseWriter, r *http.Request) {
+	ap := b.remoteConfigApp(w, r, "management")
+	if ap == nil {
+		return
+	}
+	entries, err := b.configEntries(r, ap.AppID())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting config entries", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	if entries == nil {
+		entries = []ConfigEntry{}
+	}
+	WriteJSON(w, http.StatusOK, map[string][]ConfigEntry{"entries": entries})
+}
+
+func (b *Backend) setConfigEntry(w http.ResponseWriter, r *http.Request) {
+	ap := b.remoteConfigApp(w, r, "management")
+	if ap == nil {
+		return
+	}
+	var req configEntryReq
+	if !DecodeJSON(w, r, &req) {
+		return
+	}
+	for i, rule := range req.Rules {
+		if rule.Rollout != nil && (*rule.Rollout < 0 || *rule.Rollout > 100) {
+			WriteErrorDetails(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request: rollout must be between 0 and 100",
+				map[string]any{"fields": map[string]string{"rules[" + strconv.Itoa(i) + "].rollout": "must be between 0 and 100"}})
+			return
+		}
+	}
+	entry := ConfigEntry{
+		ID:          ap.AppID() + ":" + req.Key,
+		AppID:       ap.AppID(),
+		Key:         req.Key,
+		Description: req.Description,
+		Value:       req.Value,
+		Rules:       req.Rules,
+		Updated:     time.Now().Unix(),
+	}
+	err := b.configTable.FullUpdate(r.Context(), entry.ID, entry)
+	if err == ErrNotFound {
+		err = b.configTable.Insert(r.Context(), entry)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error saving config entry", "app", ap.AppID(), "key", req.Key, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, entry)
+}
+
+func (b *Backend) deleteConfigEntry(w http.ResponseWriter, r *http.Request) {
+	ap := b.remoteConfigApp(w, r, "management")
+	if ap == nil {
+		return
+	}
+	key := r.PathValue("key")
+	err := b.configTable.Remove(r.Context(), ap.AppID()+":"+key)
+	if err != nil && err != ErrNotFound {
+		slog.ErrorContext(r.Context(), "error deleting config entry", "app", ap.AppID(), "key", key, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteSuccess(w, http.StatusOK, map[string]string{"key": key})
+}
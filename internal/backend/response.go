@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// A machine readable error code returned in ErrorResponse.ErrorCode.
+type ErrorCode string
+
+const (
+	// Backend is configured incorrectly, such as an App returning a nil crash table while the key has crash permission.
+	CodeMisconfigured ErrorCode = "misconfigured"
+	// API Key is invalid or does not have the needed permission for the request.
+	CodeInvalidKey ErrorCode = "invalidKey"
+	// No API Key was given.
+	CodeNoKey ErrorCode = "noKey"
+	// Body of the request is malformed.
+	CodeInvalidBody ErrorCode = "invalidBody"
+	// Body of the request is too large.
+	CodeTooLarge ErrorCode = "tooLarge"
+	// User is not authorized for the given task or no user token is given.
+	CodeUnauthorized ErrorCode = "unauthorized"
+	// Some part of the request is invalid.
+	CodeBadRequest ErrorCode = "badRequest"
+	// The requested item doesn't exist.
+	CodeNotFound ErrorCode = "notFound"
+	// The request is deprecated and has passed it's sunset date.
+	CodeGone ErrorCode = "gone"
+	// Server-side issue.
+	CodeInternal ErrorCode = "internal"
+	// Incorrect username or password.
+	CodeIncorrect ErrorCode = "incorrect"
+	// User is timed out due to too many failed login attempts.
+	CodeTimeout ErrorCode = "timeout"
+	// Password doesn't meet requirements.
+	CodePassword ErrorCode = "password"
+	// Username, email, or ID is already used.
+	CodeTaken ErrorCode = "taken"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+)
+
+var legacyResponses atomic.Bool
+
+// Enable or disable legacy response shapes for older clients. When enabled:
+//   - Failed logins return 200 with the error in the body.
+//   - Requests that didn't return a body on success don't return one.
+//   - Error codes given with ErrorCode.Legacy use their legacy value.
+func SetLegacyResponses(enabled bool) {
+	legacyResponses.Store(enabled)
+}
+
+// If legacy response shapes are enabled. See SetLegacyResponses.
+func LegacyResponses() bool {
+	return legacyResponses.Load()
+}
+
+// Returns old instead of c if legacy responses are enabled. Used for error codes that have changed, such as "not found" becoming notFound.
+func (c ErrorCode) Legacy(old string) ErrorCode {
+	if LegacyResponses() {
+		return ErrorCode(old)
+	}
+	return c
+}
+
+// The body of an error response.
+type ErrorResponse struct {
+	ErrorCode ErrorCode `json:"errorCode"`
+	ErrorMsg  string    `json:"errorMsg"` // Meant to be displayed to the user. May be empty.
+	// Additional information about the error, such as when a timeout ends.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// An RFC 9457 problem details response. Sent instead of ErrorResponse if the request accepts application/problem+json.
+type problemResponse struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	ErrorCode ErrorCode      `json:"errorCode"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Write v as JSON with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Write a successful response that doesn't have a natural body, such as after a delete.
+// v is returned as the body, unless legacy responses are enabled, in which case only the status is written.
+func WriteSuccess(w http.ResponseWriter, status int, v any) {
+	if LegacyResponses() {
+		w.WriteHeader(status)
+		return
+	}
+	WriteJSON(w, status, v)
+}
+
+// Write an error response. If r accepts application/problem+json, the error is sent as an RFC 9457 problem details object.
+// r may be nil.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, msg string) {
+	WriteErrorDetails(w, r, status, code, msg, nil)
+}
+
+// Return an error response with the given status code, code, and message.
+//
+// Deprecated: Use WriteError, which supports problem details responses. ReturnError will be removed in the next release.
+func ReturnError(w http.ResponseWriter, status int, code, msg string) {
+	WriteError(w, nil, status, ErrorCode(code), msg)
+}
+
+// Same as WriteError, but with additional details about the error.
+func WriteErrorDetails(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, msg string, details map[string]any) {
+	if r != nil && acceptsProblem(r) {
+		w.Header().Set("Content-Type", contentTypeProblem)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(problemResponse{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    msg,
+			ErrorCode: code,
+			Details:   details,
+		})
+		return
+	}
+	WriteJSON(w, status, ErrorResponse{
+		ErrorCode: code,
+		ErrorMsg:  msg,
+		Details:   details,
+	})
+}
+
+func acceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, typ := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(typ))
+			if err == nil && mediaType == contentTypeProblem {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// How long count logs are kept if an App doesn't implement RetentionApp.
+	DefaultLogRetention = 30 * 24 * time.Hour
+	// How often old count logs are removed, unless changed with Backend.SetCleanupInterval.
+	DefaultCleanupInterval = 24 * time.Hour
+)
+
+// The result of removing old count logs for an App.
+type CleanupResult struct {
+	AppID   string `json:"appID"`
+	Time    int64  `json:"time"`   // unix timestamp (seconds) of when the cleanup was run
+	Cutoff  int    `json:"cutoff"` // logs with a date before this were removed (YYYYMMDD)
+	Removed int    `json:"removed"`
+	DryRun  bool   `json:"dryRun"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Set how often old count logs are removed.
+func (b *Backend) SetCleanupInterval(d time.Duration) {
+	b.cleanupTicker.Reset(d)
+}
+
+var (
+	getCleanupDoc = RouteDoc{
+		Summary:    "Get the result of the last count log cleanup",
+		Tags:       []string{"count"},
+		Permission: "management",
+		Response:   CleanupResult{},
+	}
+	runCleanupDoc = RouteDoc{
+		Summary:     "Remove old count logs",
+		Description: "Removes count logs older then the App's retention period.",
+		Tags:        []string{"count"},
+		Permission:  "management",
+		Query: []Param{
+			{Name: "dryRun", Type: "boolean", Description: "If true, logs are only counted and not removed."},
+		},
+		Response: CleanupResult{},
+	}
+)
+
+func (b *Backend) cleanupLoop() {
+	b.cleanup()
+	for range b.cleanupTicker.C {
+		b.cleanup()
+	}
+}
+
+func (b *Backend) cleanup() {
+	for _, a := range b.appList() {
+		if a.CountTable() == nil {
+			continue
+		}
+		res := b.cleanupApp(context.Background(), a, false)
+		if res.Error != "" {
+			slog.Error("error removing old logs", "app", a.AppID(), "err", res.Error)
+		} else {
+			slog.Info("removed old logs", "app", a.AppID(), "removed", res.Removed, "cutoff", res.Cutoff)
+		}
+	}
+}
+
+func logRetention(ap App) time.Duration {
+	if ret, ok := ap.(RetentionApp); ok && ret.LogRetention() > 0 {
+		return ret.LogRetention()
+	}
+	return DefaultLogRetention
+}
+
+// Removes count logs older then the App's retention. If dryRun is true, logs are only counted.
+// Results that aren't dry runs are kept and returned by GET /count/cleanup.
+func (b *Backend) cleanupApp(ctx context.Context, ap App, dryRun bool) CleanupResult {
+	now := time.Now()
+	res := CleanupResult{
+		AppID:  ap.AppID(),
+		Time:   now.Unix(),
+		Cutoff: getDate(now.Add(-logRetention(ap))),
+		DryRun: dryRun,
+	}
+	var err error
+	if dryRun {
+		res.Removed, err = ap.CountTable().CountOldLogs(ctx, res.Cutoff)
+	} else {
+		res.Removed, err = ap.CountTable().RemoveOldLogs(ctx, res.Cutoff)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if !dryRun {
+		b.cleanupMutex.Lock()
+		b.lastCleanup[ap.AppID()] = res
+		b.cleanupMutex.Unlock()
+	}
+	return res
+}
+
+// Get the App from the appID path value if using the management key, otherwise the key's App.
+// If the App can't be found, or doesn't have a count table, an error response is written and nil is returned.
+func (b *Backend) countManagementApp(w http.ResponseWriter, r *http.Request, hdr *ParsedHeader) App {
+	var ap App
+	if b.isManagementKey(hdr.Key) {
+		ap = b.app(r.PathValue("appID"))
+		if ap == nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+			return nil
+		}
+	} else {
+		ap = b.GetApp(hdr.Key)
+	}
+	if ap.CountTable() == nil {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "App doesn't have a count table")
+		return nil
+	}
+	return ap
+}
+
+func (b *Backend) runCleanup(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	ap := b.countManagementApp(w, r, hdr)
+	if ap == nil {
+		return
+	}
+	res := b.cleanupApp(r.Context(), ap, r.URL.Query().Get("dryRun") == "true")
+	if res.Error != "" {
+		slog.ErrorContext(r.Context(), "error removing old logs", "app", ap.AppID(), "err", res.Error)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, res)
+}
+
+func (b *Backend) getCleanup(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	ap := b.countManagementApp(w, r, hdr)
+	if ap == nil {
+		return
+	}
+	b.cleanupMutex.Lock()
+	res, ok := b.lastCleanup[ap.AppID()]
+	b.cleanupMutex.Unlock()
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Cleanup hasn't run yet")
+		return
+	}
+	WriteJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default maximum size of a request body in bytes.
+const DefaultMaxBody = 1 << 20 // 1MB
+
+// A query, path, or header parameter of a route.
+type Param struct {
+	Name        string
+	Description string
+	// JSON schema type, such as string, integer, or boolean. Defaults to string.
+	Type     string
+	Required bool
+}
+
+// Documentation for a route. Used to generate the OpenAPI specification served at /openapi.json.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	// Used to group routes, such as by App.
+	Tags []string
+	// API Key permission needed for the request. Empty if no API Key is needed.
+	Permission string
+	// If a user's JWT token is needed for the request.
+	UserAuth bool
+	// Path parameters are found automatically and only need to be given to add a description.
+	PathParams []Param
+	Query      []Param
+	// Request body. Either a *Schema or a value who's type is used to create a Schema. nil if the request has no body.
+	Request any
+	// Content type of the request body. Defaults to application/json.
+	RequestType string
+	// Successful response body. Either a *Schema or a value who's type is used to create a Schema. nil if the response has no body.
+	Response any
+	// Content type of the response body. Defaults to application/json.
+	ResponseType string
+	// Status code of a successful response. Defaults to 200.
+	Status int
+	// Maximum size of the request body in bytes. If 0, the Router's default is used. Negative values remove the limit.
+	MaxBody int64
+	// Deprecated routes add the Deprecation and Sunset headers to responses, have their usage counted, and are removed after their sunset.
+	Deprecated bool
+	// Date a deprecated route is removed. If zero, the Router's sunset is used.
+	Sunset time.Time
+	// Path that replaces a deprecated route. Path parameters, such as {dieID}, are filled from the request.
+	Successor string
+}
+
+// A documented route.
+type Route struct {
+	Method string
+	Path   string
+	RouteDoc
+}
+
+// An http.ServeMux that keeps track of the documentation of it's routes.
+// Routes added directly to the ServeMux are served, but not documented.
+type Router struct {
+	*http.ServeMux
+	mut     sync.Mutex
+	routes  []Route
+	maxBody atomic.Int64
+	// Handlers of /{appID}/{resource} routes by method then resource.
+	appResources map[string]map[string]http.HandlerFunc
+
+	usageMut       sync.Mutex
+	sunset         time.Time
+	deprecatedDocs map[string]RouteDoc
+	usage          map[string]map[string]*DeprecatedUsage
+	usageTable     Table[DeprecatedUsage]
+	// Usage that changed since it was last saved to usageTable, keyed by ID.
+	unsaved map[string]*DeprecatedUsage
+	saving  bool
+}
+
+func NewRouter() *Router {
+	out := &Router{
+		ServeMux: http.NewServeMux(),
+	}
+	out.maxBody.Store(DefaultMaxBody)
+	return out
+}
+
+// Set the maximum size of request bodies for routes that don't set RouteDoc.MaxBody. Values <= 0 remove the limit.
+func (r *Router) SetMaxBody(size int64) {
+	r.maxBody.Store(size)
+}
+
+type bodyLimitKey struct{}
+
+// Wraps h so reading more than max bytes of the request body fails with an *http.MaxBytesError.
+func (r *Router) limitBody(h http.HandlerFunc, max int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		limit := max
+		if limit == 0 {
+			limit = r.maxBody.Load()
+		}
+		if limit <= 0 || req.Body == nil || req.Body == http.NoBody {
+			h(w, req)
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, limit)
+		h(w, req.WithContext(context.WithValue(req.Context(), bodyLimitKey{}, limit)))
+	}
+}
+
+// The body size limit of the request's route. Returns 0 if there is no limit.
+func bodyLimit(r *http.Request) int64 {
+	limit, _ := r.Context().Value(bodyLimitKey{}).(int64)
+	return limit
+}
+
+// Add a route along with it's documentation. pattern must include a method, such as "GET /count".
+func (r *Router) HandleDoc(pattern string, h http.HandlerFunc, doc RouteDoc) {
+	h = r.limitBody(h, doc.MaxBody)
+	if doc.Deprecated {
+		h = r.deprecated(pattern, h, doc)
+	}
+	r.ServeMux.HandleFunc(pattern, h)
+	method, path, _ := strings.Cut(pattern, " ")
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.routes = append(r.routes, Route{
+		Method:   strings.ToUpper(strings.TrimSpace(method)),
+		Path:     strings.TrimSpace(path),
+		RouteDoc: doc,
+	})
+}
+
+// Add a route for /{appID}/{resource}, such as GET /{appID}/count, along with it's documentation.
+// These would conflict with App routes such as GET /blog/{blogID}, since neither is more specific, so every resource of a method
+// is served by a single, less specific, METHOD /{appID}/{resource} route. If an App has a matching route, such as GET /blog/count, the App's route is used.
+func (r *Router) handleAppResource(method, resource string, h http.HandlerFunc, doc RouteDoc) {
+	method = strings.ToUpper(method)
+	docPattern := method + " /{appID}/" + resource
+	h = r.limitBody(h, doc.MaxBody)
+	if doc.Deprecated {
+		h = r.deprecated(docPattern, h, doc)
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.appResources == nil {
+		r.appResources = make(map[string]map[string]http.HandlerFunc)
+	}
+	handlers, has := r.appResources[method]
+	if !has {
+		handlers = make(map[string]http.HandlerFunc)
+		r.appResources[method] = handlers
+		r.ServeMux.HandleFunc(method+" /{appID}/{resource}", func(w http.ResponseWriter, req *http.Request) {
+			r.mut.Lock()
+			h, has := r.appResources[method][req.PathValue("resource")]
+			r.mut.Unlock()
+			if !has {
+				WriteError(w, req, http.StatusNotFound, CodeNotFound, "Not found")
+				return
+			}
+			h(w, req)
+		})
+	}
+	if _, has := handlers[resource]; has {
+		panic("multiple registrations for " + docPattern)
+	}
+	handlers[resource] = h
+	r.routes = append(r.routes, Route{
+		Method:   method,
+		Path:     "/{appID}/" + resource,
+		RouteDoc: doc,
+	})
+}
+
+// Documentation for the management key variant of a route.
+func managementDoc(doc RouteDoc) RouteDoc {
+	doc.Permission = "management"
+	doc.PathParams = append(slices.Clone(doc.PathParams), Param{Name: "appID", Description: "App to manage. Requires the management key."})
+	return doc
+}
+
+// Get a copy of the documentation marked as deprecated and replaced by successor. Useful for legacy paths of a route.
+func (d RouteDoc) Deprecate(successor string) RouteDoc {
+	d.Deprecated = true
+	d.Successor = successor
+	return d
+}
+
+// Get all documented routes sorted by path then method.
+func (r *Router) Routes() []Route {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	out := slices.Clone(r.routes)
+	slices.SortStableFunc(out, func(a, b Route) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	return out
+}
@@ -0,0 +1,257 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Dart obfuscation map, as created by flutter build's --obfuscate and --extra-gen-snapshot-options=--save-obfuscation-map.
+	// A JSON array of alternating original and obfuscated names.
+	SymbolFormatDart = "dart"
+	// Simple text mapping. One "original -> obfuscated" pair per line. Empty lines and lines starting with # are ignored.
+	SymbolFormatMapping = "mapping"
+
+	maxSymbolMapSize = 8 << 20 //8MB
+	// Symbol maps are stored as a single document, so they must fit in Mongo's 16MB document limit.
+	maxStoredSymbolMapSize = 15 << 20 //15MB
+	// Approximate number of bytes a Symbol takes when stored, not including the names.
+	storedSymbolOverhead = 48
+)
+
+var (
+	ErrSymbolFormat = errors.New("invalid symbol map format")
+
+	identifierRegex = regexp.MustCompile(`[A-Za-z_$][A-Za-z0-9_$]*`)
+	// Stack frames such as "#0      aB.c (package:app/a.dart:12:5)" (Dart) or "at aB.c(a.java:12)" (Java).
+	// The first group is the frame's class and method names.
+	frameRegex = regexp.MustCompile(`^(\s*(?:#\d+\s+|at\s+))([^\s(]+(?:\s+[^\s(]+)*?)(\s*\(.*)$`)
+	// Identifiers quoted in error messages, such as "Class 'aB' has no instance method 'c'".
+	quotedIdentRegex = regexp.MustCompile(`'[A-Za-z_$][A-Za-z0-9_$]*'`)
+)
+
+type Symbol struct {
+	Obfuscated string `json:"obfuscated" bson:"obfuscated"`
+	Original   string `json:"original" bson:"original"`
+}
+
+// Symbols used to deobfuscate crashes for a specific platform and version of an App.
+type SymbolMap struct {
+	ID       string   `json:"id" bson:"_id"`
+	Platform string   `json:"platform" bson:"platform"`
+	Version  string   `json:"version" bson:"version"`
+	Uploaded int64    `json:"uploaded" bson:"uploaded"`
+	Symbols  []Symbol `json:"symbols" bson:"symbols"`
+}
+
+func (s SymbolMap) GetID() string {
+	return s.ID
+}
+
+var uploadSymbolsDoc = RouteDoc{
+	Summary:     "Upload a symbol map",
+	Description: "Replaces any existing symbol map for the platform and version. Incoming crashes for the platform and version are deobfuscated with the map.",
+	Tags:        []string{"crash"},
+	Permission:  "management",
+	Query: []Param{
+		{Name: "platform", Required: true},
+		{Name: "version", Required: true},
+		{Name: "format", Description: "Can be dart or mapping. Defaults to dart."},
+	},
+	Request:     &Schema{Type: "string"},
+	RequestType: "application/octet-stream",
+	Response:    ObjectSchema(map[string]any{"id": "", "symbols": 0}),
+	Status:      http.StatusCreated,
+	MaxBody:     maxSymbolMapSize,
+}
+
+// Get the SymbolMap ID for the given platform and version.
+func SymbolMapID(platform, version string) string {
+	return platform + "-" + version
+}
+
+// Allows for an App to store symbol maps that are used to deobfuscate incoming crashes.
+type SymbolApp interface {
+	App
+	SymbolTable() Table[SymbolMap]
+}
+
+// Parse a symbol map in the given format (SymbolFormatDart or SymbolFormatMapping).
+func ParseSymbolMap(format string, r io.Reader) ([]Symbol, error) {
+	var out []Symbol
+	switch format {
+	case SymbolFormatDart:
+		var names []string
+		err := json.NewDecoder(r).Decode(&names)
+		if err != nil || len(names)%2 != 0 {
+			return nil, ErrSymbolFormat
+		}
+		for i := 0; i < len(names); i += 2 {
+			out = append(out, Symbol{Original: names[i], Obfuscated: names[i+1]})
+		}
+	case SymbolFormatMapping:
+		scan := bufio.NewScanner(r)
+		for scan.Scan() {
+			line := strings.TrimSpace(scan.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			orig, obf, found := strings.Cut(line, "->")
+			if !found {
+				return nil, ErrSymbolFormat
+			}
+			out = append(out, Symbol{Original: strings.TrimSpace(orig), Obfuscated: strings.TrimSpace(obf)})
+		}
+		if scan.Err() != nil {
+			return nil, scan.Err()
+		}
+	default:
+		return nil, ErrSymbolFormat
+	}
+	return out, nil
+}
+
+// Replace obfuscated class and method names in s with their original value.
+// In stack frames only the frame's class and method names are replaced, so file paths and package names are left alone.
+// In other lines, such as error messages, only identifiers in single quotes are replaced.
+func Deobfuscate(s string, symbols []Symbol) string {
+	if len(symbols) == 0 {
+		return s
+	}
+	m := make(map[string]string, len(symbols))
+	for _, sym := range symbols {
+		m[sym.Obfuscated] = sym.Original
+	}
+	replace := func(ident string) string {
+		if orig, ok := m[ident]; ok {
+			return orig
+		}
+		return ident
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if frame := frameRegex.FindStringSubmatch(l); frame != nil {
+			lines[i] = frame[1] + identifierRegex.ReplaceAllStringFunc(frame[2], replace) + frame[3]
+			continue
+		}
+		lines[i] = quotedIdentRegex.ReplaceAllStringFunc(l, func(quoted string) string {
+			return "'" + replace(quoted[1:len(quoted)-1]) + "'"
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Approximate size of the symbols when stored.
+func storedSymbolsSize(symbols []Symbol) int {
+	size := 0
+	for _, sym := range symbols {
+		size += len(sym.Obfuscated) + len(sym.Original) + storedSymbolOverhead
+	}
+	return size
+}
+
+// Deobfuscates the crash's Error and Stack if a SymbolMap is available for it's platform and version.
+// The original values are kept in RawError and RawStack. Returns false if the crash wasn't changed.
+func (b *Backend) symbolicate(ctx context.Context, ap App, crash *IndividualCrash) bool {
+	if crash.RawStack != "" {
+		return false
+	}
+	symApp, ok := ap.(SymbolApp)
+	if !ok || symApp.SymbolTable() == nil {
+		return false
+	}
+	symMap, err := symApp.SymbolTable().Get(ctx, SymbolMapID(crash.Platform, crash.Version))
+	if err != nil {
+		if err != ErrNotFound {
+			slog.ErrorContext(ctx, "error getting symbol map", "err", err)
+		}
+		return false
+	}
+	crash.RawError = crash.Error
+	crash.RawStack = crash.Stack
+	crash.Error = Deobfuscate(crash.Error, symMap.Symbols)
+	crash.Stack = Deobfuscate(crash.Stack, symMap.Symbols)
+	return true
+}
+
+func (b *Backend) uploadSymbols(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	b.actualSymbolUpload(w, r, b.GetApp(hdr.Key))
+}
+
+func (b *Backend) managementUploadSymbols(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	appID := r.PathValue("appID")
+	ap := b.app(appID)
+	if ap == nil || appID == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+		return
+	}
+	b.actualSymbolUpload(w, r, ap)
+}
+
+func (b *Backend) actualSymbolUpload(w http.ResponseWriter, r *http.Request, ap App) {
+	symApp, ok := ap.(SymbolApp)
+	if !ok || symApp.SymbolTable() == nil {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "App does not support symbol maps")
+		return
+	}
+	platform := r.URL.Query().Get("platform")
+	version := r.URL.Query().Get("version")
+	format := r.URL.Query().Get("format")
+	if platform == "" || version == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "platform and version must be specified")
+		return
+	}
+	if format == "" {
+		format = SymbolFormatDart
+	}
+	defer r.Body.Close()
+	symbols, err := ParseSymbolMap(format, r.Body)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid symbol map")
+		return
+	}
+	if storedSymbolsSize(symbols) > maxStoredSymbolMapSize {
+		WriteErrorDetails(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, "Symbol map has too many symbols", map[string]any{"symbols": len(symbols)})
+		return
+	}
+	symMap := SymbolMap{
+		ID:       SymbolMapID(platform, version),
+		Platform: platform,
+		Version:  version,
+		Uploaded: time.Now().Unix(),
+		Symbols:  symbols,
+	}
+	tab := symApp.SymbolTable()
+	err = tab.FullUpdate(r.Context(), symMap.ID, symMap)
+	if err == ErrNotFound {
+		err = tab.Insert(r.Context(), symMap)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error saving symbol map", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, map[string]any{"id": symMap.ID, "symbols": len(symbols)})
+}
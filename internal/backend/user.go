@@ -4,10 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -67,9 +66,11 @@ func (b *Backend) TryLogin(ctx context.Context, username, password string) (User
 	users, err := b.userTable.Find(ctx, map[string]any{"username": username})
 	if err == ErrNotFound {
 		return User{}, ErrLoginIncorrect
+	} else if err != nil {
+		return User{}, err
 	}
 	if len(users) > 1 {
-		log.Println("duplicate username detected, fix immediately:", username)
+		slog.ErrorContext(ctx, "duplicate username detected, fix immediately", "username", username)
 	}
 	user := users[0]
 	if time.Unix(user.Timeout, 0).After(time.Now()) {
@@ -176,9 +177,9 @@ func (u User) ValidatePassword(password string) (bool, error) {
 }
 
 type createUserRequest struct {
-	Username string
-	Password string
-	Email    string
+	Username string `json:"username" validate:"required,max=64"`
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required,max=254"`
 }
 
 type createUserReturn struct {
@@ -186,23 +187,45 @@ type createUserReturn struct {
 	Token    string `json:"token"`
 }
 
+var (
+	createUserDoc = RouteDoc{
+		Summary:    "Create a user",
+		Tags:       []string{"user"},
+		Permission: "user",
+		Request:    createUserRequest{},
+		Response:   createUserReturn{},
+		Status:     http.StatusCreated,
+	}
+	deleteUserDoc = RouteDoc{
+		Summary:    "Delete a user",
+		Tags:       []string{"user"},
+		Permission: "management",
+		Response:   ObjectSchema(map[string]any{"id": ""}),
+	}
+	loginDoc = RouteDoc{
+		Summary:     "Login",
+		Description: "Returns 401 with the incorrect error code if the username or password is incorrect, or 429 with the timeout error code if the user is timed out. With legacy responses, failures return 200 with error and errorMsg populated instead.",
+		Tags:        []string{"user"},
+		Permission:  "user",
+		Request:     loginRequest{},
+		Response:    loginReturn{},
+	}
+)
+
 func (b *Backend) createUser(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "user", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
-	defer r.Body.Close()
 	var req createUserRequest
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil || req.Username == "" || req.Password == "" || req.Email == "" {
-		ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	if !DecodeJSON(w, r, &req) {
 		return
 	}
 	if len(req.Password) < 12 || len(req.Password) > 128 {
-		ReturnError(w, http.StatusUnauthorized, "password", "Invalid password.")
+		WriteError(w, r, http.StatusUnauthorized, CodePassword, "Invalid password.")
 		return
 	}
 	// TODO: filter offensive words/phrases
@@ -210,71 +233,78 @@ func (b *Backend) createUser(w http.ResponseWriter, r *http.Request) {
 	defer b.userCreateMutex.Unlock()
 	matchUsername, err := b.userTable.Find(r.Context(), map[string]any{"username": req.Username})
 	if err != nil && !errors.Is(err, ErrNotFound) {
-		log.Println("error when checking for username collisions:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error when checking for username collisions", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	} else if (err == nil || errors.Is(err, ErrNotFound)) && len(matchUsername) > 0 {
-		ReturnError(w, http.StatusUnauthorized, "taken", "Username or email already used")
+		WriteError(w, r, http.StatusUnauthorized, CodeTaken, "Username or email already used")
 		return
 	}
 	matchEmail, err := b.userTable.Find(r.Context(), map[string]any{"email": req.Email})
 	if err != nil && !errors.Is(err, ErrNotFound) {
-		log.Println("error when checking for email collisions:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error when checking for email collisions", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	} else if (err == nil || errors.Is(err, ErrNotFound)) && len(matchEmail) > 0 {
-		ReturnError(w, http.StatusUnauthorized, "taken", "Username or email already used")
+		WriteError(w, r, http.StatusUnauthorized, CodeTaken, "Username or email already used")
 		return
 	}
 	u, err := NewUser(req.Username, req.Password, req.Email)
 	if err != nil {
-		log.Println("error creating new user:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error creating new user", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
 	err = b.userTable.Insert(r.Context(), u)
 	if err != nil {
-		log.Println("error inserting new user:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error inserting new user", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
 	var ret createUserReturn
 	ret.Username = u.Username
 	ret.Token, err = b.GenerateJWT(u.ToReqUser())
 	if err != nil {
-		log.Println("error generating token:", err)
-		ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error generating token", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(ret)
+	WriteJSON(w, http.StatusCreated, ret)
 }
 
 func (b *Backend) deleteUser(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "management", true)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
 	userID := r.PathValue("userID")
 	if userID == "" {
-		ReturnError(w, http.StatusBadRequest, "badRequest", "Bad Request")
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad Request")
 		return
 	}
 	err = b.userTable.Remove(r.Context(), userID)
 	if err != nil && err != ErrNotFound {
-		log.Println("error deleting user:", err)
+		slog.ErrorContext(r.Context(), "error deleting user", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
 	}
+	WriteSuccess(w, http.StatusOK, map[string]string{"id": userID})
 }
 
 type loginRequest struct {
-	Username string
-	Password string
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type loginReturn struct {
+	Token string `json:"token"`
+}
+
+// Login response used when legacy responses are enabled. Failed logins are returned with a 200 status.
+type legacyLoginReturn struct {
 	Token    string `json:"token"`
 	Error    string `json:"error"`
 	ErrorMsg string `json:"errorMsg"`
@@ -285,35 +315,46 @@ func (b *Backend) login(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.VerifyHeader(w, r, "user", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	}
-	defer r.Body.Close()
 	var req loginRequest
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil || req.Username == "" || req.Password == "" {
-		ReturnError(w, http.StatusBadRequest, "invalidBody", "Bad request")
+	if !DecodeJSON(w, r, &req) {
 		return
 	}
-	var ret loginReturn
 	u, err := b.TryLogin(r.Context(), req.Username, req.Password)
-	if err == nil {
-		ret.Token, err = b.GenerateJWT(u.ToReqUser())
-		if err != nil {
-			log.Println("error generating JWT token:", err)
-			ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+	switch err {
+	case nil:
+	case ErrLoginTimeout:
+		msg := fmt.Sprint("Timed out for ", time.Until(time.Unix(u.Timeout, 0)).Round(time.Second))
+		if LegacyResponses() {
+			WriteJSON(w, http.StatusOK, legacyLoginReturn{Error: string(CodeTimeout), ErrorMsg: msg, Timeout: u.Timeout})
 			return
 		}
-	} else {
-		if err == ErrLoginTimeout {
-			ret.Error = "timeout"
-			ret.ErrorMsg = fmt.Sprint("Timed out for", time.Until(time.Unix(u.Timeout, 0)), "seconds")
-			ret.Timeout = u.Timeout
-		} else {
-			ret.Error = "incorrect"
-			ret.ErrorMsg = "Incorrect username or password"
+		WriteErrorDetails(w, r, http.StatusTooManyRequests, CodeTimeout, msg, map[string]any{"timeout": u.Timeout})
+		return
+	case ErrLoginIncorrect:
+		if LegacyResponses() {
+			WriteJSON(w, http.StatusOK, legacyLoginReturn{Error: string(CodeIncorrect), ErrorMsg: "Incorrect username or password"})
+			return
 		}
+		WriteError(w, r, http.StatusUnauthorized, CodeIncorrect, "Incorrect username or password")
+		return
+	default:
+		slog.ErrorContext(r.Context(), "error logging in", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	token, err := b.GenerateJWT(u.ToReqUser())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating JWT token", "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	if LegacyResponses() {
+		WriteJSON(w, http.StatusOK, legacyLoginReturn{Token: token})
+		return
 	}
-	json.NewEncoder(w).Encode(ret)
+	WriteJSON(w, http.StatusOK, loginReturn{Token: token})
 }
@@ -0,0 +1,259 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Returned by Validate when a value doesn't meet the rules given by it's validate struct tags.
+//
+// Rules are given as a comma separated list in the validate tag, such as `validate:"required,max=64"`:
+//   - required: value must not be empty.
+//   - min=N: strings must have at least N characters, slices and maps at least N items, and numbers must be at least N.
+//   - max=N: strings must have at most N characters, slices and maps at most N items, and numbers must be at most N.
+//   - oneof=a b c: string must be one of the space separated values.
+//
+// Rules other than required check the value a pointer points to and are skipped if the pointer is nil.
+// oneof allows empty strings, so use required as well to disallow them.
+// Nested structs, including slices of structs, are validated as well.
+type ValidationError struct {
+	// Problem with each invalid field keyed by it's JSON name. Nested fields are separated by a period, such as device.model or rules[0].value.
+	Fields map[string]string
+}
+
+func (v *ValidationError) Error() string {
+	names := make([]string, 0, len(v.Fields))
+	for name := range v.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for i := range names {
+		names[i] += " " + v.Fields[names[i]]
+	}
+	return strings.Join(names, "; ")
+}
+
+// Checks v against the rules given by it's validate struct tags. Returns a *ValidationError if v is invalid.
+func Validate(v any) error {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	verr := &ValidationError{Fields: make(map[string]string)}
+	validateStruct(val, "", verr.Fields)
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func validateStruct(val reflect.Value, prefix string, fields map[string]string) {
+	t := val.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		fv := val.Field(i)
+		if problem := checkRules(fv, f.Tag.Get("validate")); problem != "" {
+			fields[prefix+name] = problem
+			continue
+		}
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		switch {
+		case fv.Kind() == reflect.Struct:
+			validateStruct(fv, prefix+name+".", fields)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct:
+			for j := range fv.Len() {
+				validateStruct(fv.Index(j), prefix+name+"["+strconv.Itoa(j)+"].", fields)
+			}
+		}
+	}
+}
+
+// Name of the field when encoded as JSON. Empty if the field is skipped.
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+// Parses a validate struct tag. Panics if the tag is malformed, since that's a programming error.
+func parseRules(tag string) []rule {
+	if tag == "" {
+		return nil
+	}
+	var out []rule
+	for _, r := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(r), "=")
+		switch name {
+		case "required":
+		case "min", "max":
+			if _, err := strconv.Atoi(arg); err != nil {
+				panic("backend: invalid validate rule " + strconv.Quote(r))
+			}
+		case "oneof":
+			if arg == "" {
+				panic("backend: invalid validate rule " + strconv.Quote(r))
+			}
+		default:
+			panic("backend: unknown validate rule " + strconv.Quote(r))
+		}
+		out = append(out, rule{name: name, arg: arg})
+	}
+	return out
+}
+
+// Returns a description of why the value is invalid, or an empty string if it's valid.
+func checkRules(v reflect.Value, tag string) string {
+	elem := v
+	for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+	for _, r := range parseRules(tag) {
+		switch r.name {
+		case "required":
+			if v.IsZero() {
+				return "is required"
+			}
+		case "min", "max":
+			n, _ := strconv.Atoi(r.arg)
+			if num, ok := numberValue(elem); ok {
+				if r.name == "min" && num < float64(n) {
+					return fmt.Sprintf("must be at least %v", n)
+				} else if r.name == "max" && num > float64(n) {
+					return fmt.Sprintf("must be at most %v", n)
+				}
+				continue
+			}
+			length, unit := valueLength(elem)
+			if length < 0 {
+				continue
+			}
+			if r.name == "min" && length < n {
+				return fmt.Sprintf("must have at least %v %v", n, unit)
+			} else if r.name == "max" && length > n {
+				return fmt.Sprintf("must have at most %v %v", n, unit)
+			}
+		case "oneof":
+			opts := strings.Fields(r.arg)
+			if elem.Kind() == reflect.String && elem.String() != "" && !slices.Contains(opts, elem.String()) {
+				return "must be one of " + strings.Join(opts, ", ")
+			}
+		}
+	}
+	return ""
+}
+
+// Value of an int, uint, or float. Returns false for other types.
+func numberValue(v reflect.Value) (float64, bool) {
+	switch {
+	case v.CanInt():
+		return float64(v.Int()), true
+	case v.CanUint():
+		return float64(v.Uint()), true
+	case v.CanFloat():
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// Length of a string, slice, or map. Returns -1 for other types.
+func valueLength(v reflect.Value) (int, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), "items"
+	}
+	return -1, ""
+}
+
+// Strictly decodes the request body as JSON into v. Unknown fields and data after the JSON value are not allowed.
+// Gzip compressed bodies are decompressed.
+func decodeJSON(r *http.Request, v any) error {
+	body, err := requestBody(r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected data after JSON body")
+		}
+		return err
+	}
+	return nil
+}
+
+// Decodes the request body as JSON into v and validates it. See Validate for how values are validated.
+// If the body is invalid or too large, an error response is written and false is returned.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := decodeJSON(r, v)
+	if err == nil {
+		err = Validate(v)
+	}
+	if err != nil {
+		WriteBodyError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// Write an error response for an error from reading, decoding, or validating the request body.
+// Bodies over the route's limit return 413, everything else returns 400.
+func WriteBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &maxErr):
+		WriteErrorDetails(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, "Request body is too large", map[string]any{"limit": maxErr.Limit})
+	case errors.As(err, &verr):
+		WriteErrorDetails(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request: "+verr.Error(), map[string]any{"fields": verr.Fields})
+	default:
+		slog.DebugContext(r.Context(), "invalid request body", "err", err)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body: "+err.Error())
+	}
+}
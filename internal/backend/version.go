@@ -0,0 +1,394 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A released version of an App.
+type Version struct {
+	// Same as Version. Versions added before the versions API may have a different ID, so versions are looked up by Version instead.
+	ID      string `json:"id" bson:"_id"`
+	Version string `json:"version" bson:"version"`
+	// unix timestamp (seconds). Used to order versions.
+	Released int64 `json:"released" bson:"released"`
+	// Platforms the version is released on. If empty, the version is on all platforms.
+	Platforms []string `json:"platforms,omitempty" bson:"platforms,omitempty"`
+	// Deprecated versions are no longer supported. Crashes from deprecated versions are not added.
+	Deprecated bool `json:"deprecated" bson:"deprecated"`
+}
+
+func (v Version) GetID() string {
+	return v.ID
+}
+
+// If the version is released on the given platform. An empty platform matches every version.
+func (v Version) OnPlatform(platform string) bool {
+	return platform == "" || len(v.Platforms) == 0 || slices.Contains(v.Platforms, platform)
+}
+
+// Allows for an App to manage it's released versions with the /versions routes.
+type VersionApp interface {
+	App
+	VersionTable() Table[Version]
+}
+
+// Implements VersionApp.VersionTable and CrashFilterApp.ShouldAddCrash for an App that embeds it.
+// Only crashes from versions in the table that support the crash's platform and aren't deprecated are added.
+type VersionFilter struct {
+	Versions Table[Version]
+}
+
+func (v VersionFilter) VersionTable() Table[Version] {
+	return v.Versions
+}
+
+// Crashes are still added if the version table can't be reached, so crashes aren't lost during an outage.
+func (v VersionFilter) ShouldAddCrash(ctx context.Context, cr IndividualCrash) bool {
+	if v.Versions == nil {
+		return true
+	}
+	vers, err := v.Versions.Find(ctx, map[string]any{"version": cr.Version})
+	if err == ErrNotFound {
+		return false
+	} else if err != nil {
+		slog.WarnContext(ctx, "error checking crash version, adding crash anyway", "version", cr.Version, "err", err)
+		return true
+	}
+	return slices.ContainsFunc(vers, func(ver Version) bool {
+		return !ver.Deprecated && ver.OnPlatform(cr.Platform)
+	})
+}
+
+type versionReq struct {
+	Version string `json:"version" validate:"required,max=64"`
+	// Defaults to the current time.
+	Released   int64    `json:"released"`
+	Platforms  []string `json:"platforms" validate:"max=32"`
+	Deprecated bool     `json:"deprecated"`
+}
+
+type supportedVersions struct {
+	Platform string `json:"platform,omitempty"`
+	Minimum  string `json:"minimum"`
+	Latest   string `json:"latest"`
+}
+
+var (
+	getVersionsDoc = RouteDoc{
+		Summary:    "Get the App's versions",
+		Tags:       []string{"version"},
+		Permission: "management",
+		Query:      []Param{{Name: "platform", Description: "Only return versions released on this platform."}},
+		Response:   ObjectSchema(map[string]any{"versions": []Version{}}),
+	}
+	addVersionDoc = RouteDoc{
+		Summary:     "Add or update a version",
+		Description: "If the version already exists, it's replaced.",
+		Tags:        []string{"version"},
+		Permission:  "management",
+		Request:     versionReq{},
+		Response:    Version{},
+		Status:      http.StatusCreated,
+	}
+	deprecateVersionDoc = RouteDoc{
+		Summary:     "Deprecate a version",
+		Description: "Crashes from deprecated versions are no longer added.",
+		Tags:        []string{"version"},
+		Permission:  "management",
+		Response:    Version{},
+	}
+	supportedVersionsDoc = RouteDoc{
+		Summary:     "Get the minimum supported and latest version",
+		Description: "The minimum supported version is the earliest released version that isn't deprecated. Returns 404 if there are no supported versions.",
+		Tags:        []string{"version"},
+		Query:       []Param{{Name: "platform", Description: "Only consider versions released on this platform."}},
+		Response:    supportedVersions{},
+	}
+)
+
+// Gets the App's VersionTable. If the App doesn't support versions, an error is written and nil is returned.
+func versionTable(w http.ResponseWriter, r *http.Request, ap App) Table[Version] {
+	verApp, ok := ap.(VersionApp)
+	if !ok || verApp.VersionTable() == nil {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "App does not support versions")
+		return nil
+	}
+	return verApp.VersionTable()
+}
+
+// Gets the App from the appID path value. If not found, an error is written and nil is returned.
+func (b *Backend) managementApp(w http.ResponseWriter, r *http.Request) App {
+	appID := r.PathValue("appID")
+	ap := b.app(appID)
+	if ap == nil || appID == "" {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Bad request")
+		return nil
+	}
+	return ap
+}
+
+// Get the versions with the given version. Versions added before the versions API may have a different ID, so versions are found by their version field.
+func findVersion(ctx context.Context, tab Table[Version], version string) ([]Version, error) {
+	vers, err := tab.Find(ctx, map[string]any{"version": version})
+	if err == nil && len(vers) == 0 {
+		err = ErrNotFound
+	}
+	return vers, err
+}
+
+// Get all versions, sorted by release date. Versions not released on platform are skipped.
+func allVersions(ctx context.Context, tab Table[Version], platform string) ([]Version, error) {
+	vers, err := tab.Find(ctx, map[string]any{})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	vers = slices.DeleteFunc(vers, func(v Version) bool {
+		return !v.OnPlatform(platform)
+	})
+	slices.SortFunc(vers, func(a, b Version) int {
+		if c := cmp.Compare(a.Released, b.Released); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Version, b.Version)
+	})
+	return vers, nil
+}
+
+func (b *Backend) getVersions(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	b.actualVersionsGet(w, r, b.GetApp(hdr.Key))
+}
+
+func (b *Backend) managementGetVersions(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	if ap := b.managementApp(w, r); ap != nil {
+		b.actualVersionsGet(w, r, ap)
+	}
+}
+
+func (b *Backend) actualVersionsGet(w http.ResponseWriter, r *http.Request, ap App) {
+	tab := versionTable(w, r, ap)
+	if tab == nil {
+		return
+	}
+	vers, err := allVersions(r.Context(), tab, r.URL.Query().Get("platform"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting versions", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	if vers == nil {
+		vers = []Version{}
+	}
+	WriteJSON(w, http.StatusOK, map[string][]Version{"versions": vers})
+}
+
+func (b *Backend) addVersion(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	b.actualVersionAdd(w, r, b.GetApp(hdr.Key))
+}
+
+func (b *Backend) managementAddVersion(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	if ap := b.managementApp(w, r); ap != nil {
+		b.actualVersionAdd(w, r, ap)
+	}
+}
+
+func (b *Backend) actualVersionAdd(w http.ResponseWriter, r *http.Request, ap App) {
+	tab := versionTable(w, r, ap)
+	if tab == nil {
+		return
+	}
+	var req versionReq
+	if !DecodeJSON(w, r, &req) {
+		return
+	}
+	ver := Version{
+		ID:         req.Version,
+		Version:    req.Version,
+		Released:   req.Released,
+		Platforms:  req.Platforms,
+		Deprecated: req.Deprecated,
+	}
+	if ver.Released == 0 {
+		ver.Released = time.Now().Unix()
+	}
+	existing, err := findVersion(r.Context(), tab, ver.Version)
+	if err == ErrNotFound {
+		err = tab.Insert(r.Context(), ver)
+	} else if err == nil {
+		// Update existing versions in place, keeping their IDs, so a version never has duplicates.
+		for _, e := range existing {
+			upd := ver
+			upd.ID = e.ID
+			err = tab.FullUpdate(r.Context(), e.ID, upd)
+			if err != nil {
+				break
+			}
+		}
+		ver.ID = existing[0].ID
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error saving version", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, ver)
+}
+
+func (b *Backend) deprecateVersion(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	b.actualVersionDeprecate(w, r, b.GetApp(hdr.Key))
+}
+
+func (b *Backend) managementDeprecateVersion(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "management", true)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	if ap := b.managementApp(w, r); ap != nil {
+		b.actualVersionDeprecate(w, r, ap)
+	}
+}
+
+func (b *Backend) actualVersionDeprecate(w http.ResponseWriter, r *http.Request, ap App) {
+	tab := versionTable(w, r, ap)
+	if tab == nil {
+		return
+	}
+	version := r.PathValue("version")
+	vers, err := findVersion(r.Context(), tab, version)
+	if err == ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Version not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error getting version", "app", ap.AppID(), "version", version, "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	for i := range vers {
+		err = tab.PartUpdate(r.Context(), vers[i].ID, map[string]any{"deprecated": true})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error deprecating version", "app", ap.AppID(), "version", version, "err", err)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+			return
+		}
+		vers[i].Deprecated = true
+	}
+	WriteJSON(w, http.StatusOK, vers[0])
+}
+
+func (b *Backend) getSupportedVersions(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.VerifyHeader(w, r, "", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	}
+	ap := b.GetApp(hdr.Key)
+	tab := versionTable(w, r, ap)
+	if tab == nil {
+		return
+	}
+	platform := r.URL.Query().Get("platform")
+	vers, err := allVersions(r.Context(), tab, platform)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting versions", "app", ap.AppID(), "err", err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Server error")
+		return
+	}
+	vers = slices.DeleteFunc(vers, func(v Version) bool {
+		return v.Deprecated
+	})
+	if len(vers) == 0 {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "No supported versions")
+		return
+	}
+	w.Header().Set("Cache-Control", "max-age=300")
+	WriteJSON(w, http.StatusOK, supportedVersions{
+		Platform: platform,
+		Minimum:  vers[0].Version,
+		Latest:   vers[len(vers)-1].Version,
+	})
+}
+
+// Compares dot separated versions, such as 1.2.10, numerically part by part. Parts that aren't numbers are compared as strings.
+// Missing parts are treated as 0, so 1.2 and 1.2.0 are equal.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := range max(len(aParts), len(bParts)) {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		aNum, aErr := strconv.Atoi(aPart)
+		bNum, bErr := strconv.Atoi(bPart)
+		var c int
+		if aErr == nil && bErr == nil {
+			c = aNum - bNum
+		} else {
+			c = strings.Compare(aPart, bPart)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// If version is between minVer and maxVer, inclusive. Empty bounds are ignored. An empty version is only in range if both bounds are empty.
+func inVersionRange(version, minVer, maxVer string) bool {
+	if minVer != "" && (version == "" || compareVersions(version, minVer) < 0) {
+		return false
+	}
+	if maxVer != "" && (version == "" || compareVersions(version, maxVer) > 0) {
+		return false
+	}
+	return true
+}
@@ -2,9 +2,8 @@ package blog
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -28,6 +27,19 @@ type Author struct {
 	PicURL string `json:"picurl" bson:"picurl"`
 }
 
+type authorRequest struct {
+	Name   string `json:"name" validate:"required,max=64"`
+	About  string `json:"about"`
+	PicURL string `json:"picurl" validate:"max=2048"`
+}
+
+// Only non-empty values are updated.
+type authorUpdateRequest struct {
+	Name   string `json:"name" validate:"max=64"`
+	About  string `json:"about"`
+	PicURL string `json:"picurl" validate:"max=2048"`
+}
+
 func (a Author) HTML() string {
 	return fmt.Sprintf(authorInfo, a.PicURL, a.Name+"'s profile picture", a.Name, a.About)
 }
@@ -35,7 +47,7 @@ func (a Author) HTML() string {
 func (b *BlogApp) AboutMe(ctx context.Context) (*Author, error) {
 	res := b.authCol.FindOne(ctx, bson.M{"_id": "BelacDarkstorm"})
 	if res.Err() != nil {
-		log.Println("error getting about me:", res.Err())
+		slog.ErrorContext(ctx, "error getting about me", "err", res.Err())
 		if res.Err() == mongo.ErrNoDocuments {
 			return nil, backend.ErrNotFound
 		}
@@ -44,7 +56,7 @@ func (b *BlogApp) AboutMe(ctx context.Context) (*Author, error) {
 	var aboutMe Author
 	err := res.Decode(&aboutMe)
 	if err != nil {
-		log.Println("error decoding about me:", res)
+		slog.ErrorContext(ctx, "error decoding about me", "err", err)
 		return nil, err
 	}
 	return &aboutMe, nil
@@ -53,45 +65,47 @@ func (b *BlogApp) AboutMe(ctx context.Context) (*Author, error) {
 func (b *BlogApp) reqAuthorInfo(w http.ResponseWriter, r *http.Request) {
 	res := b.authCol.FindOne(r.Context(), r.PathValue("authorID"))
 	if res.Err() == mongo.ErrNoDocuments {
-		backend.ReturnError(w, http.StatusNotFound, "notFound", "Author with ID "+r.PathValue("authorID")+" not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Author with ID "+r.PathValue("authorID")+" not found")
 		return
 	} else if res.Err() != nil {
-		log.Println("error getting author info:", res.Err())
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error getting author info", "err", res.Err())
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
 	var auth Author
 	err := res.Decode(&auth)
 	if err != nil {
-		log.Println("error decoding author info:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error decoding author info", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
-	json.NewEncoder(w).Encode(auth)
+	backend.WriteJSON(w, http.StatusOK, auth)
 }
 
 func (b *BlogApp) addAuthorInfo(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.back.VerifyHeader(w, r, "blogManagement", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	} else if hdr.Key.AppID != "blog" {
-		backend.ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
 		return
 	}
 	if hdr.User == nil || hdr.User.Perm["blog"] != "admin" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application is unauthorized")
 		return
 	}
-	var newAuth Author
-	err = json.NewDecoder(r.Body).Decode(&newAuth)
-	r.Body.Close()
-	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Invalid request")
+	var req authorRequest
+	if !backend.DecodeJSON(w, r, &req) {
 		return
 	}
+	newAuth := Author{
+		Name:   req.Name,
+		About:  req.About,
+		PicURL: req.PicURL,
+	}
 	for i := 1; ; i++ {
 		newID := strings.ReplaceAll(newAuth.Name, " ", "-")
 		if i != 1 {
@@ -102,65 +116,62 @@ func (b *BlogApp) addAuthorInfo(w http.ResponseWriter, r *http.Request) {
 			newAuth.ID = newID
 			break
 		} else if collisionCheck.Err() != nil {
-			log.Println("error checking for new author ID collisions:", err)
-			backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+			slog.ErrorContext(r.Context(), "error checking for new author ID collisions", "err", err)
+			backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 			return
 		}
 	}
 	_, err = b.authCol.InsertOne(r.Context(), newAuth)
 	if err != nil {
-		log.Println("error inserting new author:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error inserting new author", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": newAuth.ID})
 }
 
 func (b *BlogApp) updateAuthorInfo(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.back.VerifyHeader(w, r, "blogManagement", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	} else if hdr.Key.AppID != "blog" {
-		backend.ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
 		return
 	}
 	if hdr.User == nil || hdr.User.Perm["blog"] != "admin" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application is unauthorized")
 		return
 	}
-	var rawUpd map[string]string
-	err = json.NewDecoder(r.Body).Decode(&rawUpd)
-	r.Body.Close()
-	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Invalid request")
+	var req authorUpdateRequest
+	if !backend.DecodeJSON(w, r, &req) {
 		return
 	}
 	actlUpd := make(map[string]string)
-	if rawUpd["name"] != "" {
-		actlUpd["name"] = rawUpd["name"]
+	if req.Name != "" {
+		actlUpd["name"] = req.Name
 	}
-	if rawUpd["about"] != "" {
-		actlUpd["about"] = rawUpd["about"]
+	if req.About != "" {
+		actlUpd["about"] = req.About
 	}
-	if rawUpd["picurl"] != "" {
-		actlUpd["picurl"] = rawUpd["picurl"]
+	if req.PicURL != "" {
+		actlUpd["picurl"] = req.PicURL
 	}
 	res, err := b.authCol.UpdateByID(r.Context(), r.PathValue("authorID"), actlUpd)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			backend.ReturnError(w, http.StatusNotFound, "notFound", "Author with ID "+r.PathValue("authorID")+" not found")
+			backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Author with ID "+r.PathValue("authorID")+" not found")
 		} else {
-			log.Println("error updating author", r.PathValue("authorID")+":", err)
-			backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+			slog.ErrorContext(r.Context(), "error updating author", "authorID", r.PathValue("authorID"), "err", err)
+			backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		}
 		return
 	}
 	if res.MatchedCount == 0 {
-		backend.ReturnError(w, http.StatusNotFound, "notFound", "Author with ID "+r.PathValue("authorID")+" not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Author with ID "+r.PathValue("authorID")+" not found")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": r.PathValue("authorID")})
 }
@@ -2,9 +2,8 @@ package blog
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -37,6 +36,61 @@ type Blog struct {
 	Draft      bool   `json:"draft" bson:"draft"`
 	CreateTime int64  `json:"createTime" bson:"createTime"`
 	UpdateTime int64  `json:"updateTime" bson:"updateTime"`
+	// When the blog goes live in Unix format. 0 is published immediately.
+	// Scheduled blogs use this as their CreateTime. If it's moved up or cleared, CreateTime is kept at or before the time it went live.
+	PublishAt int64 `json:"publishAt,omitempty" bson:"publishAt,omitempty"`
+	// Normalized with NormalizeTags.
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+type blogRequest struct {
+	Favicon    string `json:"favicon" validate:"max=256"`
+	Title      string `json:"title" validate:"required,max=256"`
+	Blog       string `json:"blog" validate:"required"`
+	StaticPage bool   `json:"staticPage"`
+	Draft      bool   `json:"draft"`
+	// Unix format. If in the future, the blog isn't published until then.
+	PublishAt int64 `json:"publishAt"`
+	// Normalized with NormalizeTags.
+	Tags []string `json:"tags" validate:"max=20"`
+}
+
+// Only non-empty values are updated.
+type blogUpdateRequest struct {
+	Favicon string `json:"favicon" validate:"max=256"`
+	Title   string `json:"title" validate:"max=256"`
+	Blog    string `json:"blog"`
+	// Replaces the blog's tags if not empty. Normalized with NormalizeTags.
+	Tags []string `json:"tags" validate:"max=20"`
+	// Unix format. If set, the blog is rescheduled. 0 publishes immediately.
+	PublishAt *int64 `json:"publishAt"`
+}
+
+// Adds conditions to the filter so only published blogs match.
+// Blogs aren't published if they're drafts or their PublishAt is in the future.
+func publishedFilter(filter bson.M) bson.M {
+	filter["draft"] = false
+	filter["publishAt"] = bson.M{"$not": bson.M{"$gt": time.Now().Unix()}}
+	return filter
+}
+
+// When the next scheduled blog is published. Returns backend.ErrNotFound if no blogs are scheduled.
+func (b *BlogApp) NextScheduled(ctx context.Context) (time.Time, error) {
+	res := b.blogCol.FindOne(ctx, bson.M{"draft": false, "publishAt": bson.M{"$gt": time.Now().Unix()}}, options.FindOne().
+		SetProjection(bson.M{"publishAt": 1}).
+		SetSort(bson.M{"publishAt": 1}))
+	if res.Err() != nil {
+		if res.Err() == mongo.ErrNoDocuments {
+			return time.Time{}, backend.ErrNotFound
+		}
+		return time.Time{}, res.Err()
+	}
+	var bl Blog
+	err := res.Decode(&bl)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(bl.PublishAt, 0), nil
 }
 
 func (b *Blog) HTMX(blogApp *BlogApp, ctx context.Context) string {
@@ -54,10 +108,12 @@ func (b *Blog) HTMX(blogApp *BlogApp, ctx context.Context) string {
 	if b.UpdateTime > b.CreateTime {
 		out += fmt.Sprintf(blogUpdate, time.Unix(b.UpdateTime, 0).Format(time.DateOnly))
 	}
+	out += TagsHTMX(b.Tags)
 	out += fmt.Sprintf(blogMain, b.HTMLBlog)
 	if err == nil {
 		out += "<h2 class='blog-author-info'>About the author:</h2>" + auth.HTML()
 	}
+	out += CommentsContainer(b.ID)
 	return out
 }
 
@@ -90,9 +146,11 @@ func (b *BlogApp) Blog(ctx context.Context, ID string) (*Blog, error) {
 	blog, has := b.blogCache[ID]
 	b.cacheMutex.RUnlock()
 	if has {
+		cacheRequests.Inc("hit")
 		return &blog, nil
 	}
-	res := b.blogCol.FindOne(ctx, bson.M{"_id": ID, "draft": false})
+	cacheRequests.Inc("miss")
+	res := b.blogCol.FindOne(ctx, publishedFilter(bson.M{"_id": ID}))
 	if res.Err() != nil {
 		if res.Err() == mongo.ErrNoDocuments {
 			return nil, backend.ErrNotFound
@@ -143,23 +201,23 @@ func (b *BlogApp) CleanCache(ID string) {
 func (b *BlogApp) reqBlog(w http.ResponseWriter, r *http.Request) {
 	blogID := r.PathValue("blogID")
 	if blogID == "" {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Must provide a blogID")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest, "Must provide a blogID")
 		return
 	}
 	blog, err := b.Blog(r.Context(), blogID)
 	if err != nil {
 		if err == backend.ErrNotFound {
-			backend.ReturnError(w, http.StatusNotFound, "notFound", "Not blog found with the given ID")
+			backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Not blog found with the given ID")
 			return
 		}
-		log.Println("error getting blog:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error getting blog", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 		return
 	}
 	if r.Header.Get("Hx-Request") == "true" {
 		w.Write([]byte(blog.HTMX(b, r.Context())))
 	} else {
-		json.NewEncoder(w).Encode(blog)
+		backend.WriteJSON(w, http.StatusOK, blog)
 	}
 }
 
@@ -167,116 +225,190 @@ func (b *BlogApp) createBlog(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.back.VerifyHeader(w, r, "blogManagement", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	} else if hdr.Key.AppID != "blog" {
-		backend.ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
 		return
 	}
 	if hdr.User == nil || hdr.User.Perm["blog"] != "admin" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application is unauthorized")
 		return
 	}
-	var newBlog Blog
-	err = json.NewDecoder(r.Body).Decode(&newBlog)
-	r.Body.Close()
-	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+	var req blogRequest
+	if !backend.DecodeJSON(w, r, &req) {
 		return
 	}
+	newBlog := Blog{
+		Favicon:    req.Favicon,
+		Title:      req.Title,
+		RawBlog:    req.Blog,
+		StaticPage: req.StaticPage,
+		Draft:      req.Draft,
+		PublishAt:  req.PublishAt,
+		Tags:       NormalizeTags(req.Tags),
+	}
 	id, err := uuid.NewV7()
 	if err != nil {
-		log.Println("error generating UUID:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error generating UUID", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
 	tim := time.Now().Unix()
 	newBlog.ID = id.String()
-	newBlog.CreateTime = tim
+	newBlog.CreateTime = max(tim, newBlog.PublishAt)
 	newBlog.UpdateTime = tim
 	newBlog.Author = hdr.User.Username
-	_, err = b.blogCol.InsertOne(r.Context(), newBlog)
+	err = b.InsertBlog(r.Context(), newBlog)
 	if err != nil {
-		log.Println("error when inserting new blog:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error when inserting new blog", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": newBlog.ID})
 }
 
 func (b *BlogApp) updateBlog(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.back.VerifyHeader(w, r, "blogManagement", false)
 	if hdr == nil {
 		if err != nil {
-			log.Println("request key parsing error:", err)
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
 		}
 		return
 	} else if hdr.Key.AppID != "blog" {
-		backend.ReturnError(w, http.StatusUnauthorized, "invalidKey", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
 		return
 	}
 	if hdr.User == nil || hdr.User.Perm["blog"] != "admin" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application is unauthorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application is unauthorized")
 		return
 	}
 	if r.PathValue("blogID") == "" {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest, "Bad request")
 		return
 	}
-	var reqUpdRaw map[string]string
-	err = json.NewDecoder(r.Body).Decode(&reqUpdRaw)
-	r.Body.Close()
-	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "badRequest", "Bad request")
+	var req blogUpdateRequest
+	if !backend.DecodeJSON(w, r, &req) {
 		return
 	}
 	reqUpd := bson.M{}
-	if fav, ok := reqUpdRaw["favicon"]; ok && fav != "" {
-		reqUpd["favicon"] = fav
+	if req.Favicon != "" {
+		reqUpd["favicon"] = req.Favicon
+	}
+	if req.Title != "" {
+		reqUpd["title"] = req.Title
 	}
-	if titl, ok := reqUpdRaw["title"]; ok && titl != "" {
-		reqUpd["title"] = titl
+	if req.Blog != "" {
+		reqUpd["blog"] = req.Blog
 	}
-	if blog, ok := reqUpdRaw["blog"]; ok && blog != "" {
-		reqUpd["blog"] = blog
+	if len(req.Tags) > 0 {
+		reqUpd["tags"] = NormalizeTags(req.Tags)
 	}
-	reqUpd["updateTime"] = time.Now().Unix()
-	res, err := b.blogCol.UpdateByID(r.Context(), r.PathValue("blogID"), reqUpd)
+	now := time.Now().Unix()
+	reqUpd["updateTime"] = now
+	if req.PublishAt != nil {
+		reqUpd["publishAt"] = *req.PublishAt
+		if *req.PublishAt > now {
+			reqUpd["createTime"] = *req.PublishAt
+		}
+	}
+	b.ensureRevisionLogged(r.Context(), r.PathValue("blogID"))
+	res, err := b.blogCol.UpdateByID(r.Context(), r.PathValue("blogID"), bson.M{"$set": reqUpd})
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			backend.ReturnError(w, http.StatusNotFound, "notFound", "Blog with ID "+r.PathValue("blogID")+" not found")
+			backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Blog with ID "+r.PathValue("blogID")+" not found")
 		} else {
-			log.Println("error updating blog", r.PathValue("blogID")+":", err)
-			backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+			slog.ErrorContext(r.Context(), "error updating blog", "blogID", r.PathValue("blogID"), "err", err)
+			backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		}
 		return
 	}
 	if res.MatchedCount == 0 {
-		backend.ReturnError(w, http.StatusNotFound, "notFound", "Blog with ID "+r.PathValue("blogID")+" not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Blog with ID "+r.PathValue("blogID")+" not found")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	err = b.dateLiveBlog(r.Context(), r.PathValue("blogID"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error dating live blog", "blogID", r.PathValue("blogID"), "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	b.uncache(r.PathValue("blogID"))
+	b.addRevisionLogged(r.Context(), r.PathValue("blogID"), hdr.User.Username, now)
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": r.PathValue("blogID")})
 }
 
+// Insert a new blog. The blog's content is saved as its first revision.
 func (b *BlogApp) InsertBlog(ctx context.Context, blog Blog) error {
 	_, err := b.blogCol.InsertOne(ctx, blog)
-	return err
+	if err != nil {
+		return err
+	}
+	b.addRevisionLogged(ctx, blog.ID, blog.Author, blog.CreateTime)
+	return nil
 }
 
-func (b *BlogApp) UpdateBlog(ctx context.Context, ID string, updates bson.M) error {
+// Update a blog. The updated content is saved as a revision by editor.
+func (b *BlogApp) UpdateBlog(ctx context.Context, ID, editor string, updates bson.M) error {
+	b.ensureRevisionLogged(ctx, ID)
 	_, err := b.blogCol.UpdateByID(ctx, ID, bson.M{"$set": updates})
+	if err != nil {
+		return err
+	}
+	err = b.dateLiveBlog(ctx, ID)
+	if err != nil {
+		return err
+	}
+	b.uncache(ID)
+	b.addRevisionLogged(ctx, ID, editor, time.Now().Unix())
+	return nil
+}
+
+// Scheduled blogs are dated to their PublishAt. If a scheduled blog is made live early, such as by clearing or moving up its PublishAt,
+// its CreateTime would still be in the future, so it's dated to now instead.
+func (b *BlogApp) dateLiveBlog(ctx context.Context, ID string) error {
+	now := time.Now().Unix()
+	_, err := b.blogCol.UpdateOne(ctx, bson.M{
+		"_id":        ID,
+		"createTime": bson.M{"$gt": now},
+		"publishAt":  bson.M{"$not": bson.M{"$gt": now}},
+	}, bson.M{"$set": bson.M{"createTime": now}})
 	return err
 }
 
+// Remove a blog along with its revisions and comments.
 func (b *BlogApp) RemoveBlog(ctx context.Context, ID string) error {
 	_, err := b.blogCol.DeleteOne(ctx, bson.M{"_id": ID})
+	if err != nil {
+		return err
+	}
+	b.uncache(ID)
+	_, err = b.revCol.DeleteMany(ctx, bson.M{"blogID": ID})
+	if err != nil {
+		return err
+	}
+	_, err = b.commentCol.DeleteMany(ctx, bson.M{"blogID": ID})
 	return err
 }
 
+// Failing to save a revision doesn't fail the save itself, so errors are only logged.
+func (b *BlogApp) addRevisionLogged(ctx context.Context, blogID, editor string, tim int64) {
+	err := b.addRevision(ctx, blogID, editor, tim)
+	if err != nil {
+		slog.ErrorContext(ctx, "error saving blog revision", "blogID", blogID, "err", err)
+	}
+}
+
+func (b *BlogApp) ensureRevisionLogged(ctx context.Context, blogID string) {
+	err := b.ensureRevision(ctx, blogID)
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(ctx, "error saving blog revision before update", "blogID", blogID, "err", err)
+	}
+}
+
 func (b *BlogApp) LatestBlogs(ctx context.Context, page int64) ([]*Blog, error) {
-	res, err := b.blogCol.Find(ctx, bson.M{"staticPage": false, "draft": false}, options.Find().
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{"staticPage": false}), options.Find().
 		SetSort(bson.M{"createTime": -1}).
 		SetLimit(5).
 		SetSkip(page*5))
@@ -309,8 +441,8 @@ func (b *BlogApp) reqLatestBlogs(w http.ResponseWriter, r *http.Request) {
 	}
 	blogs, err := b.LatestBlogs(r.Context(), int64(page))
 	if err != nil && err != backend.ErrNotFound {
-		log.Println("error getting latest blogs:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "internal error")
+		slog.ErrorContext(r.Context(), "error getting latest blogs", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
 		return
 	}
 	var ret struct {
@@ -319,7 +451,7 @@ func (b *BlogApp) reqLatestBlogs(w http.ResponseWriter, r *http.Request) {
 	}
 	ret.Num = len(blogs)
 	ret.Blogs = blogs
-	json.NewEncoder(w).Encode(ret)
+	backend.WriteJSON(w, http.StatusOK, ret)
 }
 
 type BlogListResult struct {
@@ -337,7 +469,7 @@ func (b BlogListResult) HTMX() string {
 }
 
 func (b *BlogApp) BlogList(ctx context.Context, page int64) ([]BlogListResult, error) {
-	res, err := b.blogCol.Find(ctx, bson.M{"staticPage": false, "draft": false}, options.Find().
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{"staticPage": false}), options.Find().
 		SetProjection(bson.M{"_id": 1, "createTime": 1, "title": 1}).
 		SetSort(bson.M{"createTime": -1}).
 		SetLimit(50).
@@ -374,6 +506,25 @@ func (b *BlogApp) AllBlogsList(ctx context.Context) ([]BlogListResult, error) {
 	return out, nil
 }
 
+// All published blogs, including static pages. Only the ID, StaticPage, CreateTime, and UpdateTime are set.
+func (b *BlogApp) PublishedBlogs(ctx context.Context) ([]Blog, error) {
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{}), options.Find().
+		SetProjection(bson.M{"_id": 1, "staticPage": 1, "createTime": 1, "updateTime": 1}).
+		SetSort(bson.M{"createTime": -1}))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []Blog
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (b *BlogApp) reqBlogList(w http.ResponseWriter, r *http.Request) {
 	var page int
 	var err error
@@ -386,8 +537,8 @@ func (b *BlogApp) reqBlogList(w http.ResponseWriter, r *http.Request) {
 	}
 	blogList, err := b.BlogList(r.Context(), int64(page))
 	if err != nil && err != backend.ErrNotFound {
-		log.Println("error getting blog list:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "internal error")
+		slog.ErrorContext(r.Context(), "error getting blog list", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
 		return
 	}
 	var ret struct {
@@ -396,5 +547,5 @@ func (b *BlogApp) reqBlogList(w http.ResponseWriter, r *http.Request) {
 	}
 	ret.Num = len(blogList)
 	ret.BlogList = blogList
-	json.NewEncoder(w).Encode(ret)
+	backend.WriteJSON(w, http.StatusOK, ret)
 }
@@ -0,0 +1,300 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Maximum number of characters in a comment.
+	MaxCommentLength = 2000
+	// Number of comments per page.
+	CommentPageSize = 20
+	// Number of comments a user can post within commentLimitWindow.
+	commentLimit       = 5
+	commentLimitWindow = 10 * time.Minute
+
+	// Loads the blog's comments once the blog is shown.
+	blogComments   = "<div class='blog-comments' id='comments-%[1]v' hx-get='/comments/%[2]v' hx-trigger='load'></div>"
+	blogComment    = "<div class='blog-comment'><h5 class='blog-comment-author'><b>%v</b> <i>%v</i></h5><p>%v</p></div>"
+	commentsPage   = "<a class='blog-comments-page' href='#comments-%[1]v' hx-get='/comments/%[2]v?page=%[3]v' hx-target='#comments-%[1]v'>%[4]v</a>"
+	commentsHeader = "<h2 class='blog-comments-title'>Comments</h2>"
+)
+
+// Returned by AddComment if the user has posted too many comments recently.
+var ErrCommentLimit = errors.New("too many comments posted recently")
+
+// A comment on a blog. Comments aren't shown until they're approved by an admin.
+type Comment struct {
+	ID     string `json:"id" bson:"_id"`
+	BlogID string `json:"blogID" bson:"blogID"`
+	// Username of the commenter.
+	Author  string `json:"author" bson:"author"`
+	Comment string `json:"comment" bson:"comment"`
+	// Unix format
+	Time     int64 `json:"time" bson:"time"`
+	Approved bool  `json:"approved" bson:"approved"`
+}
+
+type commentRequest struct {
+	Comment string `json:"comment" validate:"required,max=2000"`
+}
+
+func (c Comment) HTMX() string {
+	return fmt.Sprintf(blogComment,
+		html.EscapeString(c.Author),
+		time.Unix(c.Time, 0).Format(time.DateOnly),
+		strings.ReplaceAll(html.EscapeString(c.Comment), "\n", "<br>"))
+}
+
+// Approved comments on the blog, oldest first. Returns up to 20 results per page.
+func (b *BlogApp) Comments(ctx context.Context, blogID string, page int64) ([]Comment, error) {
+	res, err := b.commentCol.Find(ctx, bson.M{"blogID": blogID, "approved": true}, options.Find().
+		SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(CommentPageSize).
+		SetSkip(page*CommentPageSize))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []Comment
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Comments waiting to be approved, oldest first. Returns up to 20 results per page.
+func (b *BlogApp) PendingComments(ctx context.Context, page int64) ([]Comment, error) {
+	res, err := b.commentCol.Find(ctx, bson.M{"approved": false}, options.Find().
+		SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(CommentPageSize).
+		SetSkip(page*CommentPageSize))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []Comment
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Adds a comment to the moderation queue. Returns backend.ErrNotFound if the blog isn't published or is a static page
+// and ErrCommentLimit if the user has posted 5 comments in the last 10 minutes.
+// The comment's length isn't checked.
+func (b *BlogApp) AddComment(ctx context.Context, blogID, username, comment string) (*Comment, error) {
+	bl, err := b.Blog(ctx, blogID)
+	if err != nil {
+		return nil, err
+	}
+	if bl.StaticPage {
+		return nil, backend.ErrNotFound
+	}
+	recent, err := b.commentCol.CountDocuments(ctx, bson.M{"author": username, "time": bson.M{"$gte": time.Now().Add(-commentLimitWindow).Unix()}})
+	if err != nil {
+		return nil, err
+	}
+	if recent >= commentLimit {
+		return nil, ErrCommentLimit
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	c := Comment{
+		ID:      id.String(),
+		BlogID:  blogID,
+		Author:  username,
+		Comment: comment,
+		Time:    time.Now().Unix(),
+	}
+	_, err = b.commentCol.InsertOne(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Approve a comment so it's shown on its blog. Returns backend.ErrNotFound if the comment isn't on the given blog.
+func (b *BlogApp) ApproveComment(ctx context.Context, blogID, ID string) error {
+	res, err := b.commentCol.UpdateOne(ctx, bson.M{"_id": ID, "blogID": blogID}, bson.M{"$set": bson.M{"approved": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return backend.ErrNotFound
+	}
+	return nil
+}
+
+func (b *BlogApp) RemoveComment(ctx context.Context, blogID, ID string) error {
+	_, err := b.commentCol.DeleteOne(ctx, bson.M{"_id": ID, "blogID": blogID})
+	return err
+}
+
+// Placeholder that loads the blog's comments from /comments/{blogID}.
+func CommentsContainer(blogID string) string {
+	return fmt.Sprintf(blogComments, html.EscapeString(blogID), url.PathEscape(blogID))
+}
+
+// A page of the blog's approved comments with links to the other pages. The links replace the contents of the blog's CommentsContainer.
+func (b *BlogApp) CommentsHTMX(ctx context.Context, blogID string, page int64) (string, error) {
+	comments, err := b.Comments(ctx, blogID, page)
+	if err != nil && err != backend.ErrNotFound {
+		return "", err
+	}
+	out := commentsHeader
+	if len(comments) == 0 && page == 0 {
+		out += "<p>No comments yet</p>"
+	}
+	for i := range comments {
+		out += comments[i].HTMX()
+	}
+	if page > 0 || len(comments) == CommentPageSize {
+		id, path := html.EscapeString(blogID), url.PathEscape(blogID)
+		out += "<div class='blog-comments-page-selector'>"
+		if page > 0 {
+			out += fmt.Sprintf(commentsPage, id, path, page-1, "&lt;Previous")
+		}
+		if len(comments) == CommentPageSize {
+			out += fmt.Sprintf(commentsPage, id, path, page+1, "Next&gt;")
+		}
+		out += "</div>"
+	}
+	return out, nil
+}
+
+func (b *BlogApp) reqComments(w http.ResponseWriter, r *http.Request) {
+	blogID := r.PathValue("blogID")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if r.Header.Get("Hx-Request") == "true" {
+		out, err := b.CommentsHTMX(r.Context(), blogID, int64(max(page, 0)))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error getting blog comments", "blogID", blogID, "err", err)
+			backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
+			return
+		}
+		w.Write([]byte(out))
+		return
+	}
+	comments, err := b.Comments(r.Context(), blogID, int64(max(page, 0)))
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting blog comments", "blogID", blogID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
+		return
+	}
+	if comments == nil {
+		comments = []Comment{}
+	}
+	backend.WriteJSON(w, http.StatusOK, map[string]any{"comments": comments, "num": len(comments)})
+}
+
+func (b *BlogApp) postComment(w http.ResponseWriter, r *http.Request) {
+	hdr, err := b.back.VerifyHeader(w, r, "blogComment", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return
+	} else if hdr.Key.AppID != "blog" {
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
+		return
+	}
+	if hdr.User == nil {
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Must be logged in to comment")
+		return
+	}
+	var req commentRequest
+	if !backend.DecodeJSON(w, r, &req) {
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Comment == "" {
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest, "Must provide a comment")
+		return
+	}
+	blogID := r.PathValue("blogID")
+	c, err := b.AddComment(r.Context(), blogID, hdr.User.Username, req.Comment)
+	if err == backend.ErrNotFound {
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Blog with ID "+blogID+" not found")
+		return
+	} else if err == ErrCommentLimit {
+		backend.WriteError(w, r, http.StatusTooManyRequests, backend.CodeTimeout, "Too many comments, try again later")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error adding blog comment", "blogID", blogID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": c.ID})
+}
+
+func (b *BlogApp) reqPendingComments(w http.ResponseWriter, r *http.Request) {
+	if b.verifyAdmin(w, r) == nil {
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	comments, err := b.PendingComments(r.Context(), int64(max(page, 0)))
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting pending comments", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	if comments == nil {
+		comments = []Comment{}
+	}
+	backend.WriteJSON(w, http.StatusOK, map[string][]Comment{"comments": comments})
+}
+
+func (b *BlogApp) approveComment(w http.ResponseWriter, r *http.Request) {
+	if b.verifyAdmin(w, r) == nil {
+		return
+	}
+	commentID := r.PathValue("commentID")
+	err := b.ApproveComment(r.Context(), r.PathValue("blogID"), commentID)
+	if err == backend.ErrNotFound {
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Comment not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error approving comment", "commentID", commentID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": commentID})
+}
+
+func (b *BlogApp) deleteComment(w http.ResponseWriter, r *http.Request) {
+	if b.verifyAdmin(w, r) == nil {
+		return
+	}
+	commentID := r.PathValue("commentID")
+	err := b.RemoveComment(r.Context(), r.PathValue("blogID"), commentID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error removing comment", "commentID", commentID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	backend.WriteSuccess(w, http.StatusOK, map[string]string{"id": commentID})
+}
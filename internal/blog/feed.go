@@ -0,0 +1,278 @@
+package blog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	siteURL   = "https://darkstorm.tech"
+	siteTitle = "Darkstorm.tech"
+	// Number of blogs included in the feeds.
+	feedSize = 20
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// The latest blogs that should be in the feeds, newest first. Unpublished blogs and static pages are skipped.
+func (b *BlogApp) FeedBlogs(ctx context.Context) ([]*Blog, error) {
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{"staticPage": false}), options.Find().
+		SetSort(bson.M{"createTime": -1}).
+		SetLimit(feedSize))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []*Blog
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		b.ConvertBlog(out[i])
+	}
+	return out, nil
+}
+
+// Names of the authors of the given blogs keyed by author ID. Authors that aren't found use their ID as their name.
+func (b *BlogApp) authorNames(ctx context.Context, blogs []*Blog) (map[string]string, error) {
+	out := make(map[string]string)
+	var ids []string
+	for _, bl := range blogs {
+		if _, ok := out[bl.Author]; !ok {
+			out[bl.Author] = bl.Author
+			ids = append(ids, bl.Author)
+		}
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	res, err := b.authCol.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var authors []Author
+	err = res.All(ctx, &authors)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range authors {
+		if a.Name != "" {
+			out[a.ID] = a.Name
+		}
+	}
+	return out, nil
+}
+
+// When the feed was last changed. This is the latest create or update time of the blogs.
+func feedUpdated(blogs []*Blog) time.Time {
+	var latest int64
+	for _, bl := range blogs {
+		latest = max(latest, bl.CreateTime, bl.UpdateTime)
+	}
+	return time.Unix(latest, 0).UTC()
+}
+
+func blogURL(bl *Blog) string {
+	return siteURL + "/" + bl.ID
+}
+
+// Generate an RSS 2.0 feed of the latest blogs.
+func (b *BlogApp) RSS(ctx context.Context) ([]byte, time.Time, error) {
+	blogs, err := b.FeedBlogs(ctx)
+	if err != nil && err != backend.ErrNotFound {
+		return nil, time.Time{}, err
+	}
+	names, err := b.authorNames(ctx, blogs)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	updated := feedUpdated(blogs)
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         siteTitle,
+			Link:          siteURL,
+			Description:   "Latest blogs from " + siteTitle,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Self:          atomLink{Href: siteURL + "/feed.xml", Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	for _, bl := range blogs {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       bl.Title,
+			Link:        blogURL(bl),
+			GUID:        rssGUID{IsPermaLink: true, Value: blogURL(bl)},
+			PubDate:     time.Unix(bl.CreateTime, 0).UTC().Format(time.RFC1123Z),
+			Creator:     names[bl.Author],
+			Description: bl.HTMLBlog,
+		})
+	}
+	return encodeFeed(feed, updated)
+}
+
+// Generate an Atom feed of the latest blogs.
+func (b *BlogApp) Atom(ctx context.Context) ([]byte, time.Time, error) {
+	blogs, err := b.FeedBlogs(ctx)
+	if err != nil && err != backend.ErrNotFound {
+		return nil, time.Time{}, err
+	}
+	names, err := b.authorNames(ctx, blogs)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	updated := feedUpdated(blogs)
+	feed := atomFeed{
+		Title: siteTitle,
+		ID:    siteURL + "/",
+		Links: []atomLink{
+			{Href: siteURL + "/atom.xml", Rel: "self", Type: "application/atom+xml"},
+			{Href: siteURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Updated: updated.Format(time.RFC3339),
+	}
+	for _, bl := range blogs {
+		blUpdated := max(bl.CreateTime, bl.UpdateTime)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     bl.Title,
+			ID:        blogURL(bl),
+			Link:      atomLink{Href: blogURL(bl), Rel: "alternate", Type: "text/html"},
+			Published: time.Unix(bl.CreateTime, 0).UTC().Format(time.RFC3339),
+			Updated:   time.Unix(blUpdated, 0).UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: names[bl.Author]},
+			Content:   atomContent{Type: "html", Value: bl.HTMLBlog},
+		})
+	}
+	return encodeFeed(feed, updated)
+}
+
+func encodeFeed(feed any, updated time.Time) ([]byte, time.Time, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(feed)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return buf.Bytes(), updated, nil
+}
+
+// Serves the RSS feed. Supports conditional requests with If-None-Match and If-Modified-Since.
+func (b *BlogApp) ServeRSS(w http.ResponseWriter, r *http.Request) {
+	b.serveFeed(w, r, "application/rss+xml; charset=utf-8", b.RSS)
+}
+
+// Serves the Atom feed. Supports conditional requests with If-None-Match and If-Modified-Since.
+func (b *BlogApp) ServeAtom(w http.ResponseWriter, r *http.Request) {
+	b.serveFeed(w, r, "application/atom+xml; charset=utf-8", b.Atom)
+}
+
+// How long, in seconds, the feeds can be cached. Normally 5 minutes, but shortened so the next scheduled blog shows up when it's published.
+func (b *BlogApp) feedMaxAge(ctx context.Context) int {
+	maxAge := 300
+	next, err := b.NextScheduled(ctx)
+	if err != nil {
+		if err != backend.ErrNotFound {
+			slog.ErrorContext(ctx, "error getting next scheduled blog", "err", err)
+		}
+		return maxAge
+	}
+	return min(maxAge, max(0, int(time.Until(next).Seconds())+1))
+}
+
+func (b *BlogApp) serveFeed(w http.ResponseWriter, r *http.Request, contentType string, gen func(context.Context) ([]byte, time.Time, error)) {
+	data, updated, err := gen(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating blog feed", "path", r.URL.Path, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		return
+	}
+	sum := sha256.Sum256(data)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(b.feedMaxAge(r.Context())))
+	if updated.Unix() == 0 {
+		updated = time.Time{}
+	}
+	http.ServeContent(w, r, "", updated, bytes.NewReader(data))
+}
@@ -6,24 +6,34 @@ import (
 
 	"github.com/CalebQ42/bbConvert"
 	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"github.com/CalebQ42/darkstorm-server/internal/metrics"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var cacheRequests = metrics.NewCounter("darkstorm_blog_cache_requests_total",
+	"Number of blog cache lookups by result (hit or miss).", "result")
+
 type BlogApp struct {
 	back         *backend.Backend
 	blogCol      *mongo.Collection
 	authCol      *mongo.Collection
+	revCol       *mongo.Collection
+	commentCol   *mongo.Collection
 	portfolioCol *mongo.Collection
 	conv         bbConvert.ComboConverter
 
 	cacheMutex *sync.RWMutex
 	blogCache  map[string]Blog
+
+	search searchIndex
 }
 
 func NewBlogApp(db *mongo.Database) *BlogApp {
 	out := &BlogApp{
 		blogCol:      db.Collection("blog"),
 		authCol:      db.Collection("author"),
+		revCol:       db.Collection("revisions"),
+		commentCol:   db.Collection("comments"),
 		portfolioCol: db.Collection("portfolio"),
 		conv:         bbConvert.NewComboConverter(),
 		cacheMutex:   &sync.RWMutex{},
@@ -48,16 +58,168 @@ func (b *BlogApp) AddBackend(back *backend.Backend) {
 	b.back = back
 }
 
-func (b *BlogApp) Extension(mux *http.ServeMux) {
-	mux.HandleFunc("GET /blog", b.reqLatestBlogs)
-	mux.HandleFunc("GET /blog/list", b.reqBlogList)
-	mux.HandleFunc("GET /blog/{blogID}", b.reqBlog)
-	mux.HandleFunc("POST /blog", b.createBlog)
-	mux.HandleFunc("POST /blog/{blogID}", b.updateBlog)
+func (b *BlogApp) Extension(mux *backend.Router) {
+	page := []backend.Param{{Name: "page", Type: "integer", Description: "Page of results, starting at 0."}}
+	idResponse := backend.ObjectSchema(map[string]any{"id": ""})
+	mux.HandleDoc("GET /blog", b.reqLatestBlogs, backend.RouteDoc{
+		Summary:  "Get the latest blogs",
+		Tags:     []string{"blog"},
+		Query:    page,
+		Response: backend.ObjectSchema(map[string]any{"blogs": []Blog{}, "num": 0}),
+	})
+	mux.HandleDoc("GET /blog/list", b.reqBlogList, backend.RouteDoc{
+		Summary:  "Get a list of blogs",
+		Tags:     []string{"blog"},
+		Query:    page,
+		Response: backend.ObjectSchema(map[string]any{"blogList": []BlogListResult{}, "num": 0}),
+	})
+	mux.HandleDoc("GET /blog/tag/{tag}", b.reqTaggedBlogs, backend.RouteDoc{
+		Summary:  "Get a list of blogs with a tag",
+		Tags:     []string{"blog"},
+		Query:    page,
+		Response: backend.ObjectSchema(map[string]any{"blogList": []BlogListResult{}, "num": 0}),
+	})
+	mux.HandleDoc("GET /blog/search", b.reqSearch, backend.RouteDoc{
+		Summary:     "Search blogs",
+		Description: "Searches the title and content of published blogs, best match first. Returns up to 20 results per page.",
+		Tags:        []string{"blog"},
+		Query: append([]backend.Param{
+			{Name: "q", Required: true, Description: "Search query. Words can be excluded with -word and phrases matched with quotes."},
+		}, page...),
+		Response: backend.ObjectSchema(map[string]any{"results": []SearchResult{}, "num": 0}),
+	})
+	mux.HandleDoc("GET /blog/{blogID}", b.reqBlog, backend.RouteDoc{
+		Summary:     "Get a blog",
+		Description: "If the Hx-Request header is true, the blog is returned as HTML.",
+		Tags:        []string{"blog"},
+		Response:    Blog{},
+	})
+	mux.HandleDoc("POST /blog", b.createBlog, backend.RouteDoc{
+		Summary:    "Create a blog",
+		Tags:       []string{"blog"},
+		Permission: "blogManagement",
+		UserAuth:   true,
+		Request:    blogRequest{},
+		Response:   idResponse,
+		Status:     http.StatusCreated,
+	})
+	mux.HandleDoc("POST /blog/{blogID}", b.updateBlog, backend.RouteDoc{
+		Summary:     "Update a blog",
+		Description: "Only non-empty values are updated.",
+		Tags:        []string{"blog"},
+		Permission:  "blogManagement",
+		UserAuth:    true,
+		Request:     blogUpdateRequest{},
+		Response:    idResponse,
+		Status:      http.StatusCreated,
+	})
+
+	mux.HandleDoc("GET /feed.xml", b.ServeRSS, backend.RouteDoc{
+		Summary:      "Get the RSS feed of the latest blogs",
+		Description:  "Supports conditional requests with If-None-Match and If-Modified-Since.",
+		Tags:         []string{"blog"},
+		Response:     &backend.Schema{Type: "string"},
+		ResponseType: "application/rss+xml",
+	})
+	mux.HandleDoc("GET /atom.xml", b.ServeAtom, backend.RouteDoc{
+		Summary:      "Get the Atom feed of the latest blogs",
+		Description:  "Supports conditional requests with If-None-Match and If-Modified-Since.",
+		Tags:         []string{"blog"},
+		Response:     &backend.Schema{Type: "string"},
+		ResponseType: "application/atom+xml",
+	})
+
+	// GET /blog/{blogID}/revisions would conflict with GET /blog/author/{authorID}.
+	mux.HandleDoc("GET /blog/revisions/{blogID}", b.reqRevisions, backend.RouteDoc{
+		Summary:     "Get a blog's revisions",
+		Description: "Every save of a blog is kept as a revision. Newest first.",
+		Tags:        []string{"blog"},
+		Permission:  "blogManagement",
+		UserAuth:    true,
+		Response:    backend.ObjectSchema(map[string]any{"revisions": []Revision{}}),
+	})
+	mux.HandleDoc("POST /blog/revisions/{blogID}/{revisionID}/restore", b.restoreRevision, backend.RouteDoc{
+		Summary:     "Restore a blog to a revision",
+		Description: "The blog's title, favicon, content, and tags are replaced with the revision's. The restore is saved as a new revision.",
+		Tags:        []string{"blog"},
+		Permission:  "blogManagement",
+		UserAuth:    true,
+		Response:    idResponse,
+		Status:      http.StatusCreated,
+	})
+
+	mux.HandleDoc("GET /blog/comments", b.reqPendingComments, backend.RouteDoc{
+		Summary:     "Get comments waiting for approval",
+		Description: "Oldest first. Returns up to 20 comments per page.",
+		Tags:        []string{"blog"},
+		Query:       page,
+		Permission:  "blogManagement",
+		UserAuth:    true,
+		Response:    backend.ObjectSchema(map[string]any{"comments": []Comment{}}),
+	})
+	mux.HandleDoc("GET /blog/comments/{blogID}", b.reqComments, backend.RouteDoc{
+		Summary:     "Get a blog's approved comments",
+		Description: "Oldest first. Returns up to 20 comments per page. If the Hx-Request header is true, the comments are returned as HTML.",
+		Tags:        []string{"blog"},
+		Query:       page,
+		Response:    backend.ObjectSchema(map[string]any{"comments": []Comment{}, "num": 0}),
+	})
+	mux.HandleDoc("POST /blog/comments/{blogID}", b.postComment, backend.RouteDoc{
+		Summary:     "Comment on a blog",
+		Description: "Requires a logged in user. Comments aren't shown until they're approved. Static pages can't be commented on. Users can post 5 comments every 10 minutes, after which 429 is returned.",
+		Tags:        []string{"blog"},
+		Permission:  "blogComment",
+		UserAuth:    true,
+		Request:     commentRequest{},
+		Response:    idResponse,
+		Status:      http.StatusCreated,
+	})
+	mux.HandleDoc("POST /blog/comments/{blogID}/{commentID}/approve", b.approveComment, backend.RouteDoc{
+		Summary:    "Approve a comment",
+		Tags:       []string{"blog"},
+		Permission: "blogManagement",
+		UserAuth:   true,
+		Response:   idResponse,
+		Status:     http.StatusCreated,
+	})
+	mux.HandleDoc("DELETE /blog/comments/{blogID}/{commentID}", b.deleteComment, backend.RouteDoc{
+		Summary:    "Delete a comment",
+		Tags:       []string{"blog"},
+		Permission: "blogManagement",
+		UserAuth:   true,
+		Response:   idResponse,
+	})
 
-	mux.HandleFunc("GET /blog/author/{authorID}", b.reqAuthorInfo)
-	mux.HandleFunc("POST /blog/author", b.addAuthorInfo)
-	mux.HandleFunc("POST /blog/author/{authorID}", b.updateAuthorInfo)
+	mux.HandleDoc("GET /blog/author/{authorID}", b.reqAuthorInfo, backend.RouteDoc{
+		Summary:  "Get an author",
+		Tags:     []string{"blog"},
+		Response: Author{},
+	})
+	mux.HandleDoc("POST /blog/author", b.addAuthorInfo, backend.RouteDoc{
+		Summary:    "Add an author",
+		Tags:       []string{"blog"},
+		Permission: "blogManagement",
+		UserAuth:   true,
+		Request:    authorRequest{},
+		Response:   idResponse,
+		Status:     http.StatusCreated,
+	})
+	mux.HandleDoc("POST /blog/author/{authorID}", b.updateAuthorInfo, backend.RouteDoc{
+		Summary:     "Update an author",
+		Description: "Only non-empty values are updated.",
+		Tags:        []string{"blog"},
+		Permission:  "blogManagement",
+		UserAuth:    true,
+		Request:     authorUpdateRequest{},
+		Response:    idResponse,
+		Status:      http.StatusCreated,
+	})
 
-	mux.HandleFunc("GET /blog/portfolio", b.reqPortfolio)
+	mux.HandleDoc("GET /blog/portfolio", b.reqPortfolio, backend.RouteDoc{
+		Summary:     "Get portfolio projects",
+		Description: "If the Hx-Request header is true, the projects are returned as HTML.",
+		Tags:        []string{"blog"},
+		Query:       []backend.Param{{Name: "tech", Description: "Only return projects using this technology."}},
+		Response:    Portfolio{},
+	})
 }
@@ -2,9 +2,8 @@ package blog
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
@@ -121,8 +120,8 @@ func (b *BlogApp) Projects(ctx context.Context, techFilter string) (Portfolio, e
 func (b *BlogApp) reqPortfolio(w http.ResponseWriter, r *http.Request) {
 	folio, err := b.Projects(r.Context(), r.URL.Query().Get("tech"))
 	if err != nil {
-		log.Println("error getting projects with filter", r.URL.Query().Get("tech")+":", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server Error")
+		slog.ErrorContext(r.Context(), "error getting projects", "tech", r.URL.Query().Get("tech"), "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
 		return
 	}
 	if r.Header.Get("Hx-Request") == "true" {
@@ -132,6 +131,6 @@ func (b *BlogApp) reqPortfolio(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(folio.FullHTMX(r.Context(), b, r.URL.Query().Get("tech"))))
 		}
 	} else {
-		json.NewEncoder(w).Encode(folio)
+		backend.WriteJSON(w, http.StatusOK, folio)
 	}
 }
@@ -0,0 +1,261 @@
+package blog
+
+import (
+	"context"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The content of a blog after it was saved.
+type Revision struct {
+	ID     string `json:"id" bson:"_id"`
+	BlogID string `json:"blogID" bson:"blogID"`
+	// Username of the user that saved the blog.
+	Editor string `json:"editor" bson:"editor"`
+	// Unix format
+	Time    int64    `json:"time" bson:"time"`
+	Favicon string   `json:"favicon" bson:"favicon"`
+	Title   string   `json:"title" bson:"title"`
+	RawBlog string   `json:"blog" bson:"blog"`
+	Tags    []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// Revisions of the blog, newest first.
+func (b *BlogApp) Revisions(ctx context.Context, blogID string) ([]Revision, error) {
+	res, err := b.revCol.Find(ctx, bson.M{"blogID": blogID}, options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []Revision
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Get a revision of the blog. Returns backend.ErrNotFound if the revision isn't of the given blog.
+func (b *BlogApp) Revision(ctx context.Context, blogID, revisionID string) (*Revision, error) {
+	res := b.revCol.FindOne(ctx, bson.M{"_id": revisionID, "blogID": blogID})
+	if res.Err() != nil {
+		if res.Err() == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, res.Err()
+	}
+	var rev Revision
+	err := res.Decode(&rev)
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Saves the blog's current content as a revision.
+func (b *BlogApp) addRevision(ctx context.Context, blogID, editor string, tim int64) error {
+	bl, err := b.AnyBlog(ctx, blogID)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	_, err = b.revCol.InsertOne(ctx, Revision{
+		ID:      id.String(),
+		BlogID:  blogID,
+		Editor:  editor,
+		Time:    tim,
+		Favicon: bl.Favicon,
+		Title:   bl.Title,
+		RawBlog: bl.RawBlog,
+		Tags:    bl.Tags,
+	})
+	return err
+}
+
+// Saves the blog's current content as a revision if it doesn't have any, such as blogs created before revisions were kept.
+// This way the content from before the first update can be restored.
+func (b *BlogApp) ensureRevision(ctx context.Context, blogID string) error {
+	num, err := b.revCol.CountDocuments(ctx, bson.M{"blogID": blogID}, options.Count().SetLimit(1))
+	if err != nil || num > 0 {
+		return err
+	}
+	bl, err := b.AnyBlog(ctx, blogID)
+	if err != nil {
+		return err
+	}
+	return b.addRevision(ctx, blogID, bl.Author, max(bl.CreateTime, bl.UpdateTime))
+}
+
+// Update the blog's content with the given revision. The restore is saved as a new revision by editor.
+func (b *BlogApp) RestoreRevision(ctx context.Context, blogID, revisionID, editor string) error {
+	rev, err := b.Revision(ctx, blogID, revisionID)
+	if err != nil {
+		return err
+	}
+	return b.UpdateBlog(ctx, blogID, editor, bson.M{
+		"updateTime": time.Now().Unix(),
+		"favicon":    rev.Favicon,
+		"title":      rev.Title,
+		"blog":       rev.RawBlog,
+		"tags":       rev.Tags,
+	})
+}
+
+// Remove the blog from the cache so changes are seen immediately.
+func (b *BlogApp) uncache(ID string) {
+	b.cacheMutex.Lock()
+	delete(b.blogCache, ID)
+	b.cacheMutex.Unlock()
+}
+
+// A line of a diff.
+type DiffLine struct {
+	// ' ' if the line is in both, '-' if it was removed, and '+' if it was added.
+	Op   byte
+	Text string
+}
+
+// Maximum number of line comparisons done by Diff. Larger diffs show every line as changed.
+const maxDiffWork = 4_000_000
+
+// Line by line diff from old to new.
+func Diff(old, new string) []DiffLine {
+	a := strings.Split(old, "\n")
+	c := strings.Split(new, "\n")
+	if len(a)*len(c) > maxDiffWork {
+		out := make([]DiffLine, 0, len(a)+len(c))
+		for _, l := range a {
+			out = append(out, DiffLine{'-', l})
+		}
+		for _, l := range c {
+			out = append(out, DiffLine{'+', l})
+		}
+		return out
+	}
+	// Longest common subsequence lengths of a[i:] and c[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(c)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(c) - 1; j >= 0; j-- {
+			if a[i] == c[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(c) {
+		switch {
+		case a[i] == c[j]:
+			out = append(out, DiffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{'-', a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{'+', c[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, DiffLine{'-', a[i]})
+	}
+	for ; j < len(c); j++ {
+		out = append(out, DiffLine{'+', c[j]})
+	}
+	return out
+}
+
+// Diff of the title and content of two revisions as HTML.
+func DiffHTML(old, new Revision) string {
+	out := "<pre class='revision-diff'>"
+	for _, l := range Diff("Title: "+old.Title+"\n\n"+old.RawBlog, "Title: "+new.Title+"\n\n"+new.RawBlog) {
+		class := "diff-same"
+		switch l.Op {
+		case '-':
+			class = "diff-remove"
+		case '+':
+			class = "diff-add"
+		}
+		out += "<div class='" + class + "'>" + string(l.Op) + " " + html.EscapeString(l.Text) + "</div>"
+	}
+	return out + "</pre>"
+}
+
+// Verifies the request is from the blog app and an admin user. If not, an error is written and nil is returned.
+func (b *BlogApp) verifyAdmin(w http.ResponseWriter, r *http.Request) *backend.ParsedHeader {
+	hdr, err := b.back.VerifyHeader(w, r, "blogManagement", false)
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
+		return nil
+	} else if hdr.Key.AppID != "blog" {
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeInvalidKey, "Application is unauthorized")
+		return nil
+	}
+	if hdr.User == nil || hdr.User.Perm["blog"] != "admin" {
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application is unauthorized")
+		return nil
+	}
+	return hdr
+}
+
+func (b *BlogApp) reqRevisions(w http.ResponseWriter, r *http.Request) {
+	if b.verifyAdmin(w, r) == nil {
+		return
+	}
+	blogID := r.PathValue("blogID")
+	if !b.Contains(r.Context(), blogID) {
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Blog with ID "+blogID+" not found")
+		return
+	}
+	revs, err := b.Revisions(r.Context(), blogID)
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting blog revisions", "blogID", blogID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	if revs == nil {
+		revs = []Revision{}
+	}
+	backend.WriteJSON(w, http.StatusOK, map[string][]Revision{"revisions": revs})
+}
+
+func (b *BlogApp) restoreRevision(w http.ResponseWriter, r *http.Request) {
+	hdr := b.verifyAdmin(w, r)
+	if hdr == nil {
+		return
+	}
+	blogID, revID := r.PathValue("blogID"), r.PathValue("revisionID")
+	err := b.RestoreRevision(r.Context(), blogID, revID, hdr.User.Username)
+	if err == backend.ErrNotFound {
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound, "Revision not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error restoring blog revision", "blogID", blogID, "revisionID", revID, "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server Error")
+		return
+	}
+	backend.WriteSuccess(w, http.StatusCreated, map[string]string{"id": blogID})
+}
@@ -0,0 +1,176 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"html"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Number of search results per page.
+	searchPageSize = 20
+	// Approximate length of search snippets.
+	snippetLength = 200
+)
+
+var bbTag = regexp.MustCompile(`\[/?[a-zA-Z*][^\]]*\]`)
+
+// A blog matching a search.
+type SearchResult struct {
+	ID         string  `json:"id" bson:"_id"`
+	Title      string  `json:"title" bson:"title"`
+	CreateTime int64   `json:"createTime" bson:"createTime"`
+	RawBlog    string  `json:"-" bson:"blog"`
+	Score      float64 `json:"score" bson:"score"`
+	// Part of the blog around the first match as HTML. Matching words are wrapped in <mark>.
+	Snippet string `json:"snippet" bson:"-"`
+}
+
+func (s SearchResult) HTMX() string {
+	return "<div class='search-result'>" +
+		BlogListResult{ID: s.ID, Title: html.EscapeString(s.Title)}.HTMX() +
+		"<p class='search-snippet'>" + s.Snippet + "</p></div>"
+}
+
+// Tracks if the text index used for searching has been created.
+type searchIndex struct {
+	mut     sync.Mutex
+	created bool
+}
+
+// Creates the text index used for searching, if it hasn't been created yet.
+func (b *BlogApp) ensureSearchIndex(ctx context.Context) {
+	b.search.mut.Lock()
+	defer b.search.mut.Unlock()
+	if b.search.created {
+		return
+	}
+	_, err := b.blogCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "title", Value: "text"}, {Key: "blog", Value: "text"}},
+		Options: options.Index().
+			SetName("blogSearch").
+			SetWeights(bson.D{{Key: "title", Value: 5}, {Key: "blog", Value: 1}}),
+	})
+	var cmdErr mongo.CommandError
+	if err != nil && errors.As(err, &cmdErr) && (cmdErr.Code == 85 || cmdErr.Code == 86) {
+		// A different text index already exists. Searches use it instead.
+		slog.WarnContext(ctx, "blog search index conflicts with an existing index", "err", err)
+		err = nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating blog search index", "err", err)
+		return
+	}
+	b.search.created = true
+}
+
+// Search published blogs by title and content, best match first. Static pages are skipped. Returns up to 20 results per page.
+func (b *BlogApp) Search(ctx context.Context, query string, page int64) ([]SearchResult, error) {
+	b.ensureSearchIndex(ctx)
+	score := bson.M{"$meta": "textScore"}
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{"$text": bson.M{"$search": query}, "staticPage": false}), options.Find().
+		SetProjection(bson.M{"_id": 1, "title": 1, "createTime": 1, "blog": 1, "score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "createTime", Value: -1}}).
+		SetLimit(searchPageSize).
+		SetSkip(page*searchPageSize))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []SearchResult
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	terms := searchTerms(query)
+	for i := range out {
+		out[i].Snippet = snippet(out[i].RawBlog, terms)
+		out[i].RawBlog = ""
+	}
+	return out, nil
+}
+
+// Matches the start of any of the words in a search query. Excluded words, such as -word, are skipped. nil if there are no words.
+func searchTerms(query string) *regexp.Regexp {
+	var words []string
+	for _, w := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		words = append(words, regexp.QuoteMeta(w))
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)`)
+}
+
+// Plain text around the first match of terms in the blog, with matches highlighted.
+// If nothing matches, such as when Mongo matched a different form of a word, the start of the blog is used.
+func snippet(rawBlog string, terms *regexp.Regexp) string {
+	text := strings.Join(strings.Fields(bbTag.ReplaceAllString(rawBlog, " ")), " ")
+	start := 0
+	if terms != nil {
+		if loc := terms.FindStringIndex(text); loc != nil {
+			start = max(0, loc[0]-snippetLength/4)
+		}
+	}
+	end := min(len(text), start+snippetLength)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	part := text[start:end]
+	var out strings.Builder
+	if start > 0 {
+		out.WriteString("…")
+	}
+	last := 0
+	if terms != nil {
+		for _, loc := range terms.FindAllStringIndex(part, -1) {
+			out.WriteString(html.EscapeString(part[last:loc[0]]))
+			out.WriteString("<mark>" + html.EscapeString(part[loc[0]:loc[1]]) + "</mark>")
+			last = loc[1]
+		}
+	}
+	out.WriteString(html.EscapeString(part[last:]))
+	if end < len(text) {
+		out.WriteString("…")
+	}
+	return out.String()
+}
+
+func (b *BlogApp) reqSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest, "Must provide a search query")
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	results, err := b.Search(r.Context(), query, int64(max(page, 0)))
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error searching blogs", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	backend.WriteJSON(w, http.StatusOK, map[string]any{"results": results, "num": len(results)})
+}
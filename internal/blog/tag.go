@@ -0,0 +1,100 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	blogTags = "<div class='blog-tags'>%v</div>"
+	blogTag  = "<a class='blog-tag' href='https://darkstorm.tech/tag/%[1]v' hx-push-url='true' hx-target='#content' hx-get='/tag/%[1]v'>#%[2]v</a>"
+)
+
+var tagInvalidChars = regexp.MustCompile(`[^\p{L}\p{N}_-]`)
+
+// Lowercases tags, replaces spaces with -, and removes any other characters that aren't letters, numbers, - or _.
+// Empty and duplicate tags are removed.
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.Join(strings.Fields(t), "-"))
+		t = tagInvalidChars.ReplaceAllString(t, "")
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Parse a comma separated list of tags, such as from a form. The tags are normalized with NormalizeTags.
+func ParseTags(tags string) []string {
+	return NormalizeTags(strings.Split(tags, ","))
+}
+
+// Links to the tag pages of the given tags. Empty if there are no tags.
+func TagsHTMX(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var links string
+	for _, t := range tags {
+		links += fmt.Sprintf(blogTag, url.PathEscape(t), html.EscapeString(t))
+	}
+	return fmt.Sprintf(blogTags, links)
+}
+
+// Published blogs with the given tag, newest first. Static pages are skipped. Returns up to 50 results per page.
+func (b *BlogApp) TaggedBlogs(ctx context.Context, tag string, page int64) ([]BlogListResult, error) {
+	res, err := b.blogCol.Find(ctx, publishedFilter(bson.M{"tags": tag, "staticPage": false}), options.Find().
+		SetProjection(bson.M{"_id": 1, "createTime": 1, "title": 1}).
+		SetSort(bson.M{"createTime": -1}).
+		SetLimit(50).
+		SetSkip(page*50))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, backend.ErrNotFound
+		}
+		return nil, err
+	}
+	var out []BlogListResult
+	err = res.All(ctx, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (b *BlogApp) reqTaggedBlogs(w http.ResponseWriter, r *http.Request) {
+	tags := NormalizeTags([]string{r.PathValue("tag")})
+	if len(tags) == 0 {
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest, "Must provide a tag")
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	blogList, err := b.TaggedBlogs(r.Context(), tags[0], int64(max(page, 0)))
+	if err != nil && err != backend.ErrNotFound {
+		slog.ErrorContext(r.Context(), "error getting tagged blogs", "tag", tags[0], "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "internal error")
+		return
+	}
+	var ret struct {
+		BlogList []BlogListResult `json:"blogList"`
+		Num      int              `json:"num"`
+	}
+	ret.Num = len(blogList)
+	ret.BlogList = blogList
+	backend.WriteJSON(w, http.StatusOK, ret)
+}
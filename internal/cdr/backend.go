@@ -2,7 +2,7 @@ package cdr
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -13,23 +13,27 @@ import (
 )
 
 type CDRBackend struct {
+	backend.VersionFilter
 	back *backend.Backend
 	db   *mongo.Database
 }
 
-func NewBackend(db *mongo.Database) *CDRBackend {
+func NewBackend(database *mongo.Database) *CDRBackend {
 	go func() {
 		for range time.Tick(time.Hour) {
-			log.Println("CDR: Deleting expired dice")
-			res, err := db.Collection("profiles").DeleteMany(context.Background(), bson.M{"expiration": bson.M{"$lt": time.Now().Unix()}})
-			if err == mongo.ErrNoDocuments {
+			res, err := database.Collection("profiles").DeleteMany(context.Background(), bson.M{"expiration": bson.M{"$lt": time.Now().Unix()}})
+			if err != nil {
+				if err != mongo.ErrNoDocuments {
+					slog.Error("error deleting expired dice", "app", "cdr", "err", err)
+				}
 				continue
 			}
-			log.Println("CDR: Deleted", res.DeletedCount, "dice")
+			slog.Info("deleted expired dice", "app", "cdr", "deleted", res.DeletedCount)
 		}
 	}()
 	return &CDRBackend{
-		db: db,
+		VersionFilter: backend.VersionFilter{Versions: db.NewMongoTable[backend.Version](database.Collection("versions"))},
+		db:            database,
 	}
 }
 
@@ -41,24 +45,42 @@ func (b CDRBackend) CountTable() backend.CountTable {
 	return db.NewMongoTable[backend.CountLog](b.db.Collection("logs"))
 }
 
+func (b CDRBackend) CountHistoryTable() backend.CountHistoryTable {
+	return db.NewMongoTable[backend.CountSnapshot](b.db.Collection("countHistory"))
+}
+
 func (b CDRBackend) CrashTable() backend.CrashTable {
 	return db.NewMongoCrashTable(b.db.Collection("crashes"), b.db.Collection("crashArchive"))
 }
 
-func (b *CDRBackend) AddBackend(back *backend.Backend) {
-	b.back = back
+func (b CDRBackend) SymbolTable() backend.Table[backend.SymbolMap] {
+	return db.NewMongoTable[backend.SymbolMap](b.db.Collection("symbols"))
 }
 
-func (s CDRBackend) ShouldAddCrash(ctx context.Context, cr backend.IndividualCrash) bool {
-	res := s.db.Collection("versions").FindOne(ctx, bson.M{"version": cr.Version})
-	return res.Err() == nil
+func (b *CDRBackend) AddBackend(back *backend.Backend) {
+	b.back = back
 }
 
-func (b CDRBackend) Extension(mux *http.ServeMux) {
-	mux.HandleFunc("POST /cdr/die", b.UploadDie)
-	mux.HandleFunc("GET /cdr/die/{dieID}", b.GetDie)
+func (b CDRBackend) Extension(mux *backend.Router) {
+	uploadDoc := backend.RouteDoc{
+		Summary:     "Upload a die",
+		Description: "Uploaded dice expire after 12 hours.",
+		Tags:        []string{"cdr"},
+		Permission:  "dice",
+		Request:     map[string]any{},
+		Response:    backend.ObjectSchema(map[string]any{"id": "", "expiration": int64(0)}),
+		Status:      http.StatusCreated,
+		MaxBody:     1 << 20, // 1MB
+	}
+	getDoc := backend.RouteDoc{
+		Summary:  "Get an uploaded die",
+		Tags:     []string{"cdr"},
+		Response: map[string]any{},
+	}
+	mux.HandleDoc("POST /cdr/die", b.UploadDie, uploadDoc)
+	mux.HandleDoc("GET /cdr/die/{dieID}", b.GetDie, getDoc)
 
 	//Legacy (TODO: remove this after a month or two after the applciation gets updated)
-	mux.HandleFunc("POST /upload", b.UploadDie)
-	mux.HandleFunc("GET /die/{dieID}", b.GetDie)
+	mux.HandleDoc("POST /upload", b.UploadDie, uploadDoc.Deprecate("/cdr/die"))
+	mux.HandleDoc("GET /die/{dieID}", b.GetDie, getDoc.Deprecate("/cdr/die/{dieID}"))
 }
@@ -2,8 +2,9 @@ package cdr
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -21,25 +22,28 @@ type UploadedDie struct {
 
 func (b CDRBackend) UploadDie(w http.ResponseWriter, r *http.Request) {
 	hdr, err := b.back.VerifyHeader(w, r, "dice", false)
-	if err != nil {
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
 		return
 	}
 	if hdr.Key.AppID != "cdr" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application not authorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application not authorized")
 		return
 	}
 	if r.Body == nil {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	bod, err := io.ReadAll(r.Body)
 	r.Body.Close()
-	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		backend.WriteError(w, r, http.StatusRequestEntityTooLarge, backend.CodeTooLarge.Legacy("too large"), "Die is too large to upload")
 		return
-	}
-	if len(bod) > 1048576 { //1MB
-		backend.ReturnError(w, http.StatusRequestEntityTooLarge, "too large", "Die is too large to upload")
+	} else if err != nil {
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	var toUpload = UploadedDie{
@@ -49,7 +53,7 @@ func (b CDRBackend) UploadDie(w http.ResponseWriter, r *http.Request) {
 	}
 	err = json.Unmarshal(bod, &toUpload.Die)
 	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	if toUpload.Die["uuid"] != nil {
@@ -57,30 +61,29 @@ func (b CDRBackend) UploadDie(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err = b.db.Collection("dice").InsertOne(r.Context(), toUpload)
 	if err != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error inserting die:", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error inserting die", "err", err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]any{"id": toUpload.ID, "expiration": toUpload.Expiration})
+	backend.WriteJSON(w, http.StatusCreated, map[string]any{"id": toUpload.ID, "expiration": toUpload.Expiration})
 }
 
 func (b CDRBackend) GetDie(w http.ResponseWriter, r *http.Request) {
 	res := b.db.Collection("dice").FindOne(r.Context(), bson.M{"_id": r.PathValue("dieID")})
 	if res.Err() == mongo.ErrNoDocuments {
-		backend.ReturnError(w, 404, "not found", "Die with the given id is not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound.Legacy("not found"), "Die with the given id is not found")
 		return
 	} else if res.Err() != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error getting CDR die:", res.Err())
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error getting CDR die", "err", res.Err())
 		return
 	}
 	var dieGet UploadedDie
 	err := res.Decode(&dieGet)
 	if err != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error decoding die:", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error decoding die", "err", err)
 		return
 	}
-	json.NewEncoder(w).Encode(dieGet.Die)
+	backend.WriteJSON(w, http.StatusOK, dieGet.Die)
 }
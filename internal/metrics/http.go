@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounter("darkstorm_http_requests_total",
+		"Number of HTTP requests by route pattern and status code.", "pattern", "code")
+	httpDuration = NewHistogram("darkstorm_http_request_duration_seconds",
+		"HTTP request latencies by route pattern.", nil, "pattern")
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Records request counts and latencies for the given handler.
+// Requests are labeled with the pattern of the http.ServeMux that handled the request, so h should be (or wrap) a http.ServeMux.
+func Instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		pattern := r.Pattern
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		httpRequests.Inc(pattern, strconv.Itoa(rec.status))
+		httpDuration.ObserveSince(start, pattern)
+	})
+}
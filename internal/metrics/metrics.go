@@ -0,0 +1,249 @@
+// A minimal Prometheus compatible metrics library.
+// Metrics are registered globally when created and are served in the text exposition format by Handler.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default histogram buckets for request latencies, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, m)
+	slices.SortFunc(registry, func(a, b metric) int {
+		return strings.Compare(a.name(), b.name())
+	})
+}
+
+// Serves all registered metrics in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		for _, m := range registry {
+			m.write(w)
+		}
+	})
+}
+
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) header(w io.Writer, typ string) {
+	io.WriteString(w, "# HELP "+d.metricName+" "+escapeHelp(d.help)+"\n")
+	io.WriteString(w, "# TYPE "+d.metricName+" "+typ+"\n")
+}
+
+// Formats label names and values as {name="value",...}. extra is appended as is.
+func (d desc) labelString(values []string, extra string) string {
+	if len(d.labels) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+	}
+	if extra != "" {
+		if len(d.labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Makes sure exactly one value is given per label. Missing values are set to an empty string and extra values are dropped.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		values = append(values, make([]string, max(0, len(d.labels)-len(values)))...)[:len(d.labels)]
+	}
+	return strings.Join(values, "\xff")
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// A value that can only go up, such as a number of requests.
+type Counter struct {
+	desc
+	mut    sync.Mutex
+	values map[string]float64
+}
+
+// Create and register a new Counter. When incrementing the Counter, a value must be given for each label.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		desc:   desc{metricName: name, help: help, labels: labels},
+		values: make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mut.Lock()
+	c.values[k] += v
+	c.mut.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w, "counter")
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		io.WriteString(w, c.metricName+c.labelString(strings.Split(k, "\xff"), "")+" "+formatFloat(c.values[k])+"\n")
+	}
+}
+
+// A value that can go up and down, such as the number of open connections.
+type Gauge struct {
+	Counter
+}
+
+// Create and register a new Gauge. When changing the Gauge, a value must be given for each label.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		Counter: Counter{
+			desc:   desc{metricName: name, help: help, labels: labels},
+			values: make(map[string]float64),
+		},
+	}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.header(w, "gauge")
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	for _, k := range sortedKeys(g.values) {
+		io.WriteString(w, g.metricName+g.labelString(strings.Split(k, "\xff"), "")+" "+formatFloat(g.values[k])+"\n")
+	}
+}
+
+type histogramValue struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// Counts observations, such as request durations, into buckets.
+type Histogram struct {
+	desc
+	mut     sync.Mutex
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+// Create and register a new Histogram with the given bucket upper bounds. If buckets is nil, DefaultBuckets is used.
+// When observing a value, a value must be given for each label.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, labels: labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		values:  make(map[string]*histogramValue),
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	val, ok := h.values[k]
+	if !ok {
+		val = &histogramValue{buckets: make([]uint64, len(h.buckets))}
+		h.values[k] = val
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			val.buckets[i]++
+		}
+	}
+	val.sum += v
+	val.count++
+}
+
+// Observe the time since start in seconds.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w, "histogram")
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		labels := strings.Split(k, "\xff")
+		val := h.values[k]
+		for i, b := range h.buckets {
+			io.WriteString(w, h.metricName+"_bucket"+h.labelString(labels, `le="`+formatFloat(b)+`"`)+" "+strconv.FormatUint(val.buckets[i], 10)+"\n")
+		}
+		io.WriteString(w, h.metricName+"_bucket"+h.labelString(labels, `le="+Inf"`)+" "+strconv.FormatUint(val.count, 10)+"\n")
+		io.WriteString(w, h.metricName+"_sum"+h.labelString(labels, "")+" "+formatFloat(val.sum)+"\n")
+		io.WriteString(w, h.metricName+"_count"+h.labelString(labels, "")+" "+strconv.FormatUint(val.count, 10)+"\n")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
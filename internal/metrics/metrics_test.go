@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func()
+		want  string
+	}{
+		{
+			name: "counter without labels",
+			setup: func() {
+				c := NewCounter("requests_total", "Number of requests.")
+				c.Inc()
+				c.Add(2.5)
+			},
+			want: `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total 3.5
+`,
+		},
+		{
+			name: "counter with labels sorted by value",
+			setup: func() {
+				c := NewCounter("requests_total", "Number of requests.", "path", "code")
+				c.Inc("/b", "200")
+				c.Inc("/a", "500")
+				c.Inc("/a", "200")
+				c.Inc("/a", "200")
+			},
+			want: `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{path="/a",code="200"} 2
+requests_total{path="/a",code="500"} 1
+requests_total{path="/b",code="200"} 1
+`,
+		},
+		{
+			name: "missing and extra label values",
+			setup: func() {
+				c := NewCounter("requests_total", "Number of requests.", "path", "code")
+				c.Inc("/a")
+				c.Inc("/a", "200", "extra")
+			},
+			want: `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{path="/a",code=""} 1
+requests_total{path="/a",code="200"} 1
+`,
+		},
+		{
+			name: "label and help escaping",
+			setup: func() {
+				c := NewCounter("escaped_total", "Back\\slash and\nnewline.", "value")
+				c.Inc(`quote " back \ line` + "\n")
+			},
+			want: `# HELP escaped_total Back\\slash and\nnewline.
+# TYPE escaped_total counter
+escaped_total{value="quote \" back \\ line\n"} 1
+`,
+		},
+		{
+			name: "gauge",
+			setup: func() {
+				g := NewGauge("active", "Active connections.", "kind")
+				g.Inc("tcp")
+				g.Inc("tcp")
+				g.Dec("tcp")
+				g.Dec("udp")
+			},
+			want: `# HELP active Active connections.
+# TYPE active gauge
+active{kind="tcp"} 1
+active{kind="udp"} -1
+`,
+		},
+		{
+			name: "histogram buckets, sum, and count",
+			setup: func() {
+				h := NewHistogram("latency_seconds", "Latency.", []float64{1, 0.5, 2}, "route")
+				h.Observe(0.25, "/a")
+				h.Observe(0.5, "/a")
+				h.Observe(1.5, "/a")
+				h.Observe(4, "/a")
+				h.Observe(1, "/b")
+			},
+			want: `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.5"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="2"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 6.25
+latency_seconds_count{route="/a"} 4
+latency_seconds_bucket{route="/b",le="0.5"} 0
+latency_seconds_bucket{route="/b",le="1"} 1
+latency_seconds_bucket{route="/b",le="2"} 1
+latency_seconds_bucket{route="/b",le="+Inf"} 1
+latency_seconds_sum{route="/b"} 1
+latency_seconds_count{route="/b"} 1
+`,
+		},
+		{
+			name: "histogram without labels",
+			setup: func() {
+				h := NewHistogram("size_bytes", "Size.", []float64{10})
+				h.Observe(math.Inf(1))
+			},
+			want: `# HELP size_bytes Size.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="10"} 0
+size_bytes_bucket{le="+Inf"} 1
+size_bytes_sum +Inf
+size_bytes_count 1
+`,
+		},
+		{
+			name: "metrics sorted by name",
+			setup: func() {
+				NewCounter("b_total", "B.").Inc()
+				NewGauge("c", "C.")
+				NewCounter("a_total", "A.").Inc()
+			},
+			want: `# HELP a_total A.
+# TYPE a_total counter
+a_total 1
+# HELP b_total B.
+# TYPE b_total counter
+b_total 1
+# HELP c C.
+# TYPE c gauge
+`,
+		},
+	}
+	saved := registry
+	defer func() { registry = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry = nil
+			tt.setup()
+			w := httptest.NewRecorder()
+			Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
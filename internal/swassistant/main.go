@@ -2,7 +2,7 @@ package swassistant
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -13,23 +13,27 @@ import (
 )
 
 type SWBackend struct {
+	backend.VersionFilter
 	back *backend.Backend
 	db   *mongo.Database
 }
 
-func NewSWBackend(db *mongo.Database) *SWBackend {
+func NewSWBackend(database *mongo.Database) *SWBackend {
 	go func() {
 		for range time.Tick(time.Hour) {
-			log.Println("SWAssistant: Deleting expired profiles")
-			res, err := db.Collection("profiles").DeleteMany(context.Background(), bson.M{"expiration": bson.M{"$lt": time.Now().Unix()}})
-			if err == mongo.ErrNoDocuments {
+			res, err := database.Collection("profiles").DeleteMany(context.Background(), bson.M{"expiration": bson.M{"$lt": time.Now().Unix()}})
+			if err != nil {
+				if err != mongo.ErrNoDocuments {
+					slog.Error("error deleting expired profiles", "app", "swassistant", "err", err)
+				}
 				continue
 			}
-			log.Println("SWAssistant: Deleted", res.DeletedCount, "profiles")
+			slog.Info("deleted expired profiles", "app", "swassistant", "deleted", res.DeletedCount)
 		}
 	}()
 	return &SWBackend{
-		db: db,
+		VersionFilter: backend.VersionFilter{Versions: db.NewMongoTable[backend.Version](database.Collection("versions"))},
+		db:            database,
 	}
 }
 
@@ -41,32 +45,73 @@ func (s *SWBackend) CountTable() backend.CountTable {
 	return db.NewMongoTable[backend.CountLog](s.db.Collection("logs"))
 }
 
+func (s *SWBackend) CountHistoryTable() backend.CountHistoryTable {
+	return db.NewMongoTable[backend.CountSnapshot](s.db.Collection("countHistory"))
+}
+
 func (s *SWBackend) CrashTable() backend.CrashTable {
 	return db.NewMongoCrashTable(s.db.Collection("crashes"), s.db.Collection("crashArchive"))
 }
 
-func (s *SWBackend) AddBackend(b *backend.Backend) {
-	s.back = b
+func (s *SWBackend) SymbolTable() backend.Table[backend.SymbolMap] {
+	return db.NewMongoTable[backend.SymbolMap](s.db.Collection("symbols"))
 }
 
-func (s *SWBackend) ShouldAddCrash(ctx context.Context, cr backend.IndividualCrash) bool {
-	res := s.db.Collection("versions").FindOne(ctx, bson.M{"version": cr.Version})
-	return res.Err() != mongo.ErrNoDocuments
+func (s *SWBackend) AddBackend(b *backend.Backend) {
+	s.back = b
 }
 
-func (s *SWBackend) Extension(mux *http.ServeMux) {
-	mux.HandleFunc("GET /swa/room", s.ListRooms)
-	mux.HandleFunc("POST /swa/room", s.NewRoom)
-	mux.HandleFunc("GET /swa/room/{roomID}", s.GetRoom)
+func (s *SWBackend) Extension(mux *backend.Router) {
+	listRoomsDoc := backend.RouteDoc{
+		Summary:    "List the user's rooms",
+		Tags:       []string{"swassistant"},
+		Permission: "rooms",
+		UserAuth:   true,
+		Response:   backend.ArraySchema(backend.ObjectSchema(map[string]any{"id": "", "name": "", "owner": ""})),
+	}
+	newRoomDoc := backend.RouteDoc{
+		Summary:    "Create a room",
+		Tags:       []string{"swassistant"},
+		Permission: "rooms",
+		UserAuth:   true,
+		Query:      []backend.Param{{Name: "name", Required: true}},
+		Response:   backend.ObjectSchema(map[string]any{"id": "", "name": ""}),
+	}
+	getRoomDoc := backend.RouteDoc{
+		Summary:    "Get a room",
+		Tags:       []string{"swassistant"},
+		Permission: "rooms",
+		UserAuth:   true,
+		Response:   Room{},
+	}
+	uploadProfileDoc := backend.RouteDoc{
+		Summary:     "Upload a profile",
+		Description: "Uploaded profiles expire after 12 hours.",
+		Tags:        []string{"swassistant"},
+		Permission:  "profile",
+		Query:       []backend.Param{{Name: "type", Required: true, Description: "Can be character, vehicle, or minion."}},
+		Request:     map[string]any{},
+		Response:    backend.ObjectSchema(map[string]any{"id": "", "expiration": int64(0)}),
+		Status:      http.StatusCreated,
+		MaxBody:     5 << 20, // 5MB
+	}
+	getProfileDoc := backend.RouteDoc{
+		Summary:  "Get an uploaded profile",
+		Tags:     []string{"swassistant"},
+		Response: map[string]any{},
+	}
+	mux.HandleDoc("GET /swa/room", s.ListRooms, listRoomsDoc)
+	mux.HandleDoc("POST /swa/room", s.NewRoom, newRoomDoc)
+	mux.HandleDoc("GET /swa/room/{roomID}", s.GetRoom, getRoomDoc)
 
-	mux.HandleFunc("POST /swa/profile", s.UploadProfile)
-	mux.HandleFunc("GET /swa/profile/{profileID}", s.GetProfile)
+	mux.HandleDoc("POST /swa/profile", s.UploadProfile, uploadProfileDoc)
+	mux.HandleDoc("GET /swa/profile/{profileID}", s.GetProfile, getProfileDoc)
 
 	//Legacy (TODO: remove this after a month or two after the applciation gets updated)
-	mux.HandleFunc("GET /room/list", s.ListRooms)
-	mux.HandleFunc("POST /room/new", s.NewRoom)
-	mux.HandleFunc("GET /room/{roomID}", s.GetRoom)
+	mux.HandleDoc("GET /room/list", s.ListRooms, listRoomsDoc.Deprecate("/swa/room"))
+	mux.HandleDoc("POST /room/new", s.NewRoom, newRoomDoc.Deprecate("/swa/room"))
+	mux.HandleDoc("GET /room/{roomID}", s.GetRoom, getRoomDoc.Deprecate("/swa/room/{roomID}"))
 
-	mux.HandleFunc("POST /profile/upload", s.UploadProfile)
-	mux.HandleFunc("GET /profile/{profileID}", s.GetProfile)
+	mux.HandleDoc("POST /profile/upload", s.UploadProfile, uploadProfileDoc.Deprecate("/swa/profile"))
+	mux.HandleDoc("GET /profile/{profileID}", s.GetProfile, getProfileDoc.Deprecate("/swa/profile/{profileID}"))
 }
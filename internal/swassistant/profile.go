@@ -2,8 +2,9 @@ package swassistant
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -22,35 +23,39 @@ type UploadedProf struct {
 
 func (s *SWBackend) UploadProfile(w http.ResponseWriter, r *http.Request) {
 	hdr, err := s.back.VerifyHeader(w, r, "profile", false)
-	if err != nil {
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
 		return
 	}
 	if hdr.Key.AppID != "swassistant" {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application not authorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application not authorized")
 		return
 	}
 	profType := r.URL.Query().Get("type")
 	if profType == "" || (profType != "character" && profType != "vehicle" && profType != "minion") {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	if r.Body == nil {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	data, err := io.ReadAll(r.Body)
 	r.Body.Close()
-	if err != nil || len(data) == 0 {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		backend.WriteError(w, r, http.StatusRequestEntityTooLarge, backend.CodeTooLarge.Legacy("too large"), "Profile is too large")
 		return
-	} else if len(data) > 5242880 { // 5MB
-		backend.ReturnError(w, http.StatusRequestEntityTooLarge, "too large", "Profile is too large")
+	} else if err != nil || len(data) == 0 {
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	prof := make(map[string]any)
 	err = json.Unmarshal(data, &prof)
 	if err != nil {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent a bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent a bad request")
 		return
 	}
 	delete(prof, "uid")
@@ -62,31 +67,30 @@ func (s *SWBackend) UploadProfile(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err = s.db.Collection("profiles").InsertOne(r.Context(), toUpload)
 	if err != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error inserting profile:", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error inserting profile", "err", err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]any{"id": toUpload.ID, "expiration": toUpload.Expiration})
+	backend.WriteJSON(w, http.StatusCreated, map[string]any{"id": toUpload.ID, "expiration": toUpload.Expiration})
 }
 
 func (s *SWBackend) GetProfile(w http.ResponseWriter, r *http.Request) {
 	res := s.db.Collection("profiles").FindOne(r.Context(), bson.M{"_id": r.PathValue("profileID")})
 	if res.Err() == mongo.ErrNoDocuments {
-		backend.ReturnError(w, 404, "not found", "Profile not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound.Legacy("not found"), "Profile not found")
 		return
 	} else if res.Err() != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error getting profile:", res.Err())
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error getting profile", "err", res.Err())
 		return
 	}
 	var prof UploadedProf
 	err := res.Decode(&prof)
 	if err != nil {
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
-		log.Println("error decoding profile:", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
+		slog.ErrorContext(r.Context(), "error decoding profile", "err", err)
 		return
 	}
 	prof.Profile["type"] = prof.Type
-	json.NewEncoder(w).Encode(prof.Profile)
+	backend.WriteJSON(w, http.StatusOK, prof.Profile)
 }
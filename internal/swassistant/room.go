@@ -1,8 +1,7 @@
 package swassistant
 
 import (
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/CalebQ42/darkstorm-server/internal/backend"
@@ -22,18 +21,21 @@ type Room struct {
 
 func (s *SWBackend) ListRooms(w http.ResponseWriter, r *http.Request) {
 	hdr, err := s.back.VerifyHeader(w, r, "rooms", false)
-	if err != nil {
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
 		return
 	}
 	if hdr.Key.AppID != "swassistant" || hdr.User == nil {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application not authorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application not authorized")
 		return
 	}
 	res, err := s.db.Collection("rooms").Find(r.Context(), bson.M{"users": hdr.User.Username},
 		options.Find().SetProjection(bson.M{"_id": 1, "name": 1, "owner": 1}))
 	if err != nil && err != mongo.ErrNoDocuments {
-		log.Println("error getting room list:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error getting room list", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 		return
 	}
 	out := make([]struct {
@@ -44,26 +46,29 @@ func (s *SWBackend) ListRooms(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		err = res.All(r.Context(), &out)
 		if err != nil {
-			log.Println("error decoding room list:", err)
-			backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+			slog.ErrorContext(r.Context(), "error decoding room list", "err", err)
+			backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 			return
 		}
 	}
-	json.NewEncoder(w).Encode(out)
+	backend.WriteJSON(w, http.StatusOK, out)
 }
 
 func (s *SWBackend) NewRoom(w http.ResponseWriter, r *http.Request) {
 	hdr, err := s.back.VerifyHeader(w, r, "rooms", false)
-	if err != nil {
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
 		return
 	}
 	if hdr.Key.AppID != "swassistant" || hdr.User == nil {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application not authorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application not authorized")
 		return
 	}
 	name := r.URL.Query().Get("name")
 	if name == "" {
-		backend.ReturnError(w, http.StatusBadRequest, "bad request", "Application sent bad request")
+		backend.WriteError(w, r, http.StatusBadRequest, backend.CodeBadRequest.Legacy("bad request"), "Application sent bad request")
 		return
 	}
 	//TODO: check room name for unsavory words
@@ -76,38 +81,41 @@ func (s *SWBackend) NewRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err = s.db.Collection("rooms").InsertOne(r.Context(), newRoom)
 	if err != nil {
-		log.Println("error creating room:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error creating room", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{"id": newRoom.ID, "name": newRoom.Name})
+	backend.WriteJSON(w, http.StatusOK, map[string]string{"id": newRoom.ID, "name": newRoom.Name})
 }
 
 func (s *SWBackend) GetRoom(w http.ResponseWriter, r *http.Request) {
 	hdr, err := s.back.VerifyHeader(w, r, "rooms", false)
-	if err != nil {
+	if hdr == nil {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "request key parsing error", "err", err)
+		}
 		return
 	}
 	if hdr.Key.AppID != "swassistant" || hdr.User == nil {
-		backend.ReturnError(w, http.StatusUnauthorized, "unauthorized", "Application not authorized")
+		backend.WriteError(w, r, http.StatusUnauthorized, backend.CodeUnauthorized, "Application not authorized")
 		return
 	}
 	roomID := r.PathValue("roomID")
 	res := s.db.Collection("rooms").FindOne(r.Context(), bson.M{"_id": roomID})
 	if res.Err() == mongo.ErrNoDocuments {
-		backend.ReturnError(w, http.StatusNotFound, "not found", "Room not found")
+		backend.WriteError(w, r, http.StatusNotFound, backend.CodeNotFound.Legacy("not found"), "Room not found")
 		return
 	} else if res.Err() != nil {
-		log.Println("error getting room:", res.Err())
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error getting room", "err", res.Err())
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 		return
 	}
 	var rm Room
 	err = res.Decode(&rm)
 	if err != nil {
-		log.Println("error decoding room:", err)
-		backend.ReturnError(w, http.StatusInternalServerError, "internal", "Server error")
+		slog.ErrorContext(r.Context(), "error decoding room", "err", err)
+		backend.WriteError(w, r, http.StatusInternalServerError, backend.CodeInternal, "Server error")
 		return
 	}
-	json.NewEncoder(w).Encode(rm)
+	backend.WriteJSON(w, http.StatusOK, rm)
 }
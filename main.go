@@ -4,7 +4,8 @@ import (
 	"context"
 	"flag"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -18,10 +19,12 @@ import (
 	"github.com/CalebQ42/darkstorm-server/internal/backend/db"
 	"github.com/CalebQ42/darkstorm-server/internal/blog"
 	"github.com/CalebQ42/darkstorm-server/internal/cdr"
+	"github.com/CalebQ42/darkstorm-server/internal/metrics"
 	"github.com/CalebQ42/darkstorm-server/internal/swassistant"
 	"github.com/inetaf/tcpproxy"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var (
@@ -30,6 +33,11 @@ var (
 	blogApp     *blog.BlogApp
 	webRoot     *string
 	testing     *bool
+
+	legacySunset *string
+	appsFile     *string
+	robotsFile   *string
+	mgmtKey      *string
 )
 
 func main() {
@@ -37,25 +45,46 @@ func main() {
 	webRoot = flag.String("web-root", "", "Sets root directory of web server.")
 	addr := flag.String("addr", ":443", "Set listen address. Defaults to \":443\"")
 	testing = flag.Bool("testing", false, "Start in testing mode. If you don't know what this is, don't use it.")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on the given address, such as \"localhost:9100\". Disabled if empty.")
+	legacySunset = flag.String("legacy-sunset", "", "Date (YYYY-MM-DD) after which deprecated API routes return 410 Gone. Never if empty.")
+	appsFile = flag.String("apps", "", "JSON file of additional apps to add to the backend. See backend.AppConfig.")
+	robotsFile = flag.String("robots", "", "File served as the website's robots.txt. A Sitemap line is added if missing. Only the editor is disallowed if empty.")
+	mgmtKey = flag.String("management-key", "", "AppID of the management key, which can manage every app and use /apps. Management routes refuse every key if empty.")
+	legacyResponses := flag.Bool("legacy-responses", true, "Use legacy API response shapes for older clients, such as returning failed logins with a 200 status. Enabled until shipped SWAssistant and CDR clients support the new responses.")
+	logLevel := flag.String("log-level", "info", "Set the log level. Can be debug, info, warn, or error.")
+	logFormat := flag.String("log-format", "text", "Set the log format. Can be text or json.")
 	flag.Parse()
+	logger, err := backend.NewLogger(*logLevel, *logFormat)
+	if err != nil {
+		fatal("invalid logging flags", "err", err)
+	}
+	slog.SetDefault(logger)
+	backend.SetLegacyResponses(*legacyResponses)
 	if *testing {
 		*addr = ":4242"
 	}
 	if !*testing && flag.NArg() != 1 {
-		log.Fatal("You must specify key directory. ex: darkstorm-server /etc/web-keys")
+		fatal("You must specify key directory. ex: darkstorm-server /etc/web-keys")
 	}
 	if *mongoURL == "" || *webRoot == "" {
-		log.Fatal("SPECIFY MONGO AND WEB-ROOT OR I WILL DIE, OH NO, THEY'RE COMING FOR ME.... **DEATH NOISES**")
+		fatal("SPECIFY MONGO AND WEB-ROOT OR I WILL DIE, OH NO, THEY'RE COMING FOR ME.... **DEATH NOISES**")
 	}
 	if !*testing {
 		go func() {
-			log.Println("error redirecting http traffic:",
-				http.ListenAndServe(":80", http.RedirectHandler("https://darkstorm.tech", http.StatusPermanentRedirect)))
+			slog.Error("error redirecting http traffic",
+				"err", http.ListenAndServe(":80", http.RedirectHandler("https://darkstorm.tech", http.StatusPermanentRedirect)))
+		}()
+	}
+	if *metricsAddr != "" {
+		go func() {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("GET /metrics", metrics.Handler())
+			slog.Error("error serving metrics", "err", http.ListenAndServe(*metricsAddr, metricsMux))
 		}()
 	}
 	proxy, err := setupTCPForward()
 	if err != nil {
-		log.Println("error setting up tcp proxy:", err)
+		slog.Error("error setting up tcp proxy", "err", err)
 	} else {
 		defer proxy.Close()
 	}
@@ -65,35 +94,61 @@ func main() {
 	setupWebsite(mux)
 	serv := &http.Server{
 		Addr:    *addr,
-		Handler: mux,
+		Handler: backend.RequestLogger(metrics.Instrument(mux)),
 	}
 	if *testing {
 		err = serv.ListenAndServe()
 	} else {
 		err = serv.ListenAndServeTLS(filepath.Join(flag.Arg(0), "fullchain.pem"), filepath.Join(flag.Arg(0), "key.pem"))
 	}
-	log.Println("webserver closed:", err)
+	slog.Error("webserver closed", "err", err)
+}
+
+// Log the message as an error and exit.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func setupTCPForward() (*tcpproxy.Proxy, error) {
 	var proxy tcpproxy.Proxy
-	proxy.AddRoute(":22", tcpproxy.To(":2222"))
+	proxy.AddRoute(":22", countedTarget{Target: tcpproxy.To(":2222"), route: ":22"})
 	err := proxy.Start()
 	return &proxy, err
 }
 
+var (
+	proxyConnections = metrics.NewCounter("darkstorm_tcpproxy_connections_total",
+		"Number of connections handled by the TCP proxy by route.", "route")
+	proxyActive = metrics.NewGauge("darkstorm_tcpproxy_active_connections",
+		"Number of currently open TCP proxy connections by route.", "route")
+)
+
+// Counts connections to a tcpproxy.Target
+type countedTarget struct {
+	tcpproxy.Target
+	route string
+}
+
+func (c countedTarget) HandleConn(conn net.Conn) {
+	proxyConnections.Inc(c.route)
+	proxyActive.Inc(c.route)
+	defer proxyActive.Dec(c.route)
+	c.Target.HandleConn(conn)
+}
+
 func setupMongo(uri string) {
 	if !*testing {
 		var err error
 		mongoClient, err = mongo.Connect(context.Background(), options.Client().ApplyURI(uri).SetTimeout(5*time.Second))
 		if err != nil {
-			log.Fatal("error connecting to mongo:", err)
+			fatal("error connecting to mongo", "err", err)
 		}
 	} else {
 		var err error
 		mongoClient, err = mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
 		if err != nil {
-			log.Fatal("error connecting to mongo:", err)
+			fatal("error connecting to mongo", "err", err)
 		}
 	}
 }
@@ -115,22 +170,22 @@ func setupBackend(mux *http.ServeMux) {
 		var pub, priv []byte
 		pubFil, err = os.Open(filepath.Join(flag.Arg(0), "darkstorm-pub.key"))
 		if err != nil {
-			log.Println("error openning darkstorm user public key:", err)
+			slog.Error("error openning darkstorm user public key", "err", err)
 			goto here
 		}
 		pub, err = io.ReadAll(pubFil)
 		if err != nil {
-			log.Println("error reading darkstorm user public key:", err)
+			slog.Error("error reading darkstorm user public key", "err", err)
 			goto here
 		}
 		privFil, err = os.Open(filepath.Join(flag.Arg(0), "darkstorm-priv.key"))
 		if err != nil {
-			log.Println("error openning darkstorm user private key:", err)
+			slog.Error("error openning darkstorm user private key", "err", err)
 			goto here
 		}
 		priv, err = io.ReadAll(privFil)
 		if err != nil {
-			log.Println("error reading darkstorm user private key:", err)
+			slog.Error("error reading darkstorm user private key", "err", err)
 			goto here
 		}
 		back.AddUserAuth(db.NewMongoTable[backend.User](mongoClient.Database("darkstorm").Collection("users")), priv, pub)
@@ -139,17 +194,65 @@ func setupBackend(mux *http.ServeMux) {
 	}
 here:
 	if err != nil {
-		log.Fatal("error setting up backend:", err)
+		fatal("error setting up backend", "err", err)
+	}
+	if *legacySunset != "" {
+		sunset, err := time.Parse(time.DateOnly, *legacySunset)
+		if err != nil {
+			fatal("invalid legacy-sunset date", "err", err)
+		}
+		back.SetLegacySunset(sunset)
+	}
+	if *mgmtKey != "" {
+		back.EnableManagementKey(*mgmtKey)
+	}
+	err = back.EnableAppConfig(context.Background(), db.MongoAppTables(mongoClient),
+		db.NewMongoTable[backend.AppConfig](mongoClient.Database("darkstorm").Collection("apps")))
+	if err != nil {
+		fatal("error loading saved apps", "err", err)
+	}
+	if *appsFile != "" {
+		loadAppsFile(*appsFile)
+	}
+	back.EnableRemoteConfig(db.NewMongoTable[backend.ConfigEntry](mongoClient.Database("darkstorm").Collection("config")))
+	back.EnableAnnouncements(db.NewMongoTable[backend.Announcement](mongoClient.Database("darkstorm").Collection("announcements")))
+	err = back.PersistDeprecatedUsage(context.Background(), db.NewMongoTable[backend.DeprecatedUsage](mongoClient.Database("darkstorm").Collection("deprecations")))
+	if err != nil {
+		fatal("error loading deprecated route usage", "err", err)
 	}
+	back.AddHealthCheck("mongo", backend.PingerFunc(func(ctx context.Context) error {
+		return mongoClient.Ping(ctx, readpref.Primary())
+	}))
 	if !*testing {
 		mux.Handle("api.darkstorm.tech/", back)
 	} else {
 		go func() {
-			http.ListenAndServe(":2323", back)
+			http.ListenAndServe(":2323", backend.RequestLogger(metrics.Instrument(back)))
 		}()
 	}
 }
 
+// Add the apps declared in the given JSON file to the backend. Apps that were already added, such as apps saved in the apps collection, are skipped.
+func loadAppsFile(name string) {
+	fil, err := os.Open(name)
+	if err != nil {
+		fatal("error opening apps file", "err", err)
+	}
+	defer fil.Close()
+	confs, err := backend.LoadAppConfigs(fil)
+	if err != nil {
+		fatal("error reading apps file", "err", err)
+	}
+	for _, c := range confs {
+		err = back.AddAppConfig(c)
+		if err == backend.ErrDuplicateApp {
+			slog.Warn("app from apps file already exists, skipping", "app", c.ID)
+		} else if err != nil {
+			fatal("error adding app from apps file", "app", c.ID, "err", err)
+		}
+	}
+}
+
 func setupWebsite(mux *http.ServeMux) {
 	if !*testing {
 		rpgUrl, _ := url.Parse("https://localhost:30000")
@@ -162,10 +265,20 @@ func setupWebsite(mux *http.ServeMux) {
 	mux.HandleFunc("GET /files/{w...}", filesRequest)
 	mux.HandleFunc("GET /portfolio", portfolioRequest)
 	mux.HandleFunc("GET /list", blogListHandle)
+	mux.HandleFunc("GET /tag/{tag}", tagHandle)
+	mux.HandleFunc("GET /search", searchHandle)
+	mux.HandleFunc("GET /comments/{blogID}", commentsHandle)
+	mux.HandleFunc("POST /comments/{blogID}", commentPostHandle)
+	mux.HandleFunc("GET /comment-login", commentLoginPageRequest)
+	mux.HandleFunc("POST /comment-login", commentLoginRequest)
+	mux.HandleFunc("GET /feed.xml", blogApp.ServeRSS)
+	mux.HandleFunc("GET /atom.xml", blogApp.ServeAtom)
+	mux.HandleFunc("GET /sitemap.xml", sitemapHandle)
+	mux.HandleFunc("GET /robots.txt", robotsHandle)
 
 	err := setupEditorTemplates()
 	if err != nil {
-		log.Println("error setting up editor templates:", err)
+		slog.Error("error setting up editor templates", "err", err)
 		return
 	}
 	// Editor stuff
@@ -174,6 +287,12 @@ func setupWebsite(mux *http.ServeMux) {
 	mux.HandleFunc("DELETE /editor/edit", editorDelete)
 	mux.HandleFunc("GET /editor/edit", editorEdit)
 	mux.HandleFunc("POST /editor/post", editorPost)
+	mux.HandleFunc("GET /editor/revisions", editorRevisions)
+	mux.HandleFunc("GET /editor/diff", editorDiff)
+	mux.HandleFunc("POST /editor/restore", editorRestore)
+	mux.HandleFunc("GET /editor/comments", editorComments)
+	mux.HandleFunc("POST /editor/comments/approve", editorApproveComment)
+	mux.HandleFunc("DELETE /editor/comments", editorDeleteComment)
 	mux.HandleFunc("POST /login", trueLoginRequest)
 }
 
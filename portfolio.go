@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -15,7 +15,7 @@ func portfolioRequest(w http.ResponseWriter, r *http.Request) {
 	selectedTech := r.URL.Query().Get("tech")
 	proj, err := blogApp.Projects(r.Context(), selectedTech)
 	if err != nil {
-		log.Println("error getting portfolio projects:", err)
+		slog.ErrorContext(r.Context(), "error getting portfolio projects", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		sendContent(w, r, "Error getting portfolio", "", "")
 		return
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/darkstorm-server/internal/backend"
+)
+
+const (
+	siteURL = "https://darkstorm.tech"
+
+	defaultRobots = `User-agent: *
+Disallow: /editor/
+Disallow: /login
+`
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func (s *sitemapURLSet) add(loc string, lastMod time.Time) {
+	u := sitemapURL{Loc: siteURL + loc}
+	if !lastMod.IsZero() {
+		u.LastMod = lastMod.UTC().Format(time.DateOnly)
+	}
+	s.URLs = append(s.URLs, u)
+}
+
+// Generate the sitemap. Returns the sitemap and when it was last modified.
+func generateSitemap(r *http.Request) ([]byte, time.Time, error) {
+	blogs, err := blogApp.PublishedBlogs(r.Context())
+	if err != nil && err != backend.ErrNotFound {
+		return nil, time.Time{}, err
+	}
+	var latest time.Time
+	newer := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	var blogLatest time.Time
+	var set sitemapURLSet
+	for _, bl := range blogs {
+		mod := time.Unix(max(bl.CreateTime, bl.UpdateTime), 0)
+		if !bl.StaticPage && mod.After(blogLatest) {
+			blogLatest = mod
+		}
+		newer(mod)
+	}
+	set.add("/", blogLatest)
+	set.add("/list", blogLatest)
+	set.add("/portfolio", time.Time{})
+	for _, bl := range blogs {
+		set.add("/"+bl.ID, time.Unix(max(bl.CreateTime, bl.UpdateTime), 0))
+	}
+	// Static pages are directories in the web root with an index.html, such as /about/index.html.
+	ents, err := os.ReadDir(*webRoot)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, e := range ents {
+		if !e.IsDir() || e.Name() == "files" || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(*webRoot, e.Name(), "index.html"))
+		if err != nil {
+			continue
+		}
+		set.add("/"+e.Name(), stat.ModTime())
+		newer(stat.ModTime())
+	}
+	filesRoot := filepath.Join(*webRoot, "files")
+	err = filepath.WalkDir(filesRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == filesRoot {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != filesRoot {
+			return filepath.SkipDir
+		}
+		inf, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(*webRoot, p)
+		set.add(path.Join("/", filepath.ToSlash(rel))+"/", inf.ModTime())
+		newer(inf.ModTime())
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err = enc.Encode(set)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return buf.Bytes(), latest, nil
+}
+
+func sitemapHandle(w http.ResponseWriter, r *http.Request) {
+	data, mod, err := generateSitemap(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating sitemap", "err", err)
+		http.Error(w, "Error generating sitemap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	http.ServeContent(w, r, "", mod, bytes.NewReader(data))
+}
+
+// Serves the robots.txt given with -robots, or a default one that only disallows the editor.
+// A Sitemap line pointing at /sitemap.xml is added if the file doesn't have one.
+func robotsHandle(w http.ResponseWriter, r *http.Request) {
+	robots := []byte(defaultRobots)
+	if *robotsFile != "" {
+		var err error
+		robots, err = os.ReadFile(*robotsFile)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error reading robots file, using default", "file", *robotsFile, "err", err)
+			robots = []byte(defaultRobots)
+		}
+	}
+	if !bytes.Contains(bytes.ToLower(robots), []byte("sitemap:")) {
+		if len(robots) > 0 && robots[len(robots)-1] != '\n' {
+			robots = append(robots, '\n')
+		}
+		robots = append(robots, []byte("\nSitemap: "+siteURL+"/sitemap.xml\n")...)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(robots)
+}
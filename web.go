@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -30,13 +30,13 @@ func sendContent(w http.ResponseWriter, r *http.Request, content string, title s
 	}
 	indexFile, err := os.Open(filepath.Join(*webRoot, "index.html"))
 	if err != nil {
-		log.Println("error when opening main index.html:", err)
+		slog.ErrorContext(r.Context(), "error when opening main index.html", "err", err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 	dat, err := io.ReadAll(indexFile)
 	if err != nil {
-		log.Println("error reading main index.html:", err)
+		slog.ErrorContext(r.Context(), "error reading main index.html", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}